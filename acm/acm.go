@@ -0,0 +1,326 @@
+// Package acm stores the configuration data of the services in a config
+// center and notifies their changes. The data types are generated by
+// protoc-gen-microgo from the messages reserving "acm", the servers, the data
+// id and the name of the data.
+package acm
+
+import (
+	"context"
+	"fmt"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultPollInterval = 10 * time.Second
+
+var (
+	// ErrNotFound is returned by a backend for a data id without content.
+	ErrNotFound = fmt.Errorf("acm data not found")
+	// ErrNoClient is returned by the package functions before SetClient.
+	ErrNoClient = fmt.Errorf("acm client not set")
+)
+
+// IAcmData is implemented by the generated data types.
+type IAcmData interface {
+	DataId() string
+	Name() string
+	Marshal() (string, error)
+	// Unmarshal returns a new value of the data type decoded from content.
+	Unmarshal(content string) (interface{}, error)
+}
+
+// Backend stores the contents of the data by data id.
+type Backend interface {
+	Get(dataId string) (string, error)
+	Put(dataId, content string) error
+}
+
+// Watcher is implemented by the backends pushing the changes of a content.
+// The channel receives the content each time it changes, the current one
+// first, and is closed when ctx is done.
+type Watcher interface {
+	Watch(ctx context.Context, dataId string) (<-chan string, error)
+}
+
+type Option func(c *Client)
+
+// WithPollInterval sets the interval at which the data are read again from a
+// backend that is not a Watcher.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// Client pushes and pulls the data to a backend, the subscribed and the
+// registered data are watched and their last value cached.
+type Client struct {
+	backend  Backend
+	interval time.Duration
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+type watch struct {
+	data       IAcmData
+	cancel     context.CancelFunc
+	registered bool
+	subs       []*subscription
+
+	loaded  bool
+	content string
+	value   interface{}
+}
+
+type subscription struct {
+	fn func(value interface{})
+}
+
+func NewClient(backend Backend, options ...Option) *Client {
+	c := &Client{
+		backend:  backend,
+		interval: defaultPollInterval,
+		watches:  make(map[string]*watch),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Push stores data in the backend.
+func (c *Client) Push(data IAcmData) error {
+	content, err := data.Marshal()
+	if err != nil {
+		return err
+	}
+	return c.backend.Put(data.DataId(), content)
+}
+
+// Pull returns the value of the data type of data, from the cache once the
+// data is watched and else from the backend.
+func (c *Client) Pull(data IAcmData) (interface{}, error) {
+	c.mu.Lock()
+	if w, ok := c.watches[data.DataId()]; ok && w.loaded {
+		value := w.value
+		c.mu.Unlock()
+		return value, nil
+	}
+	c.mu.Unlock()
+
+	content, err := c.backend.Get(data.DataId())
+	if err != nil {
+		return nil, err
+	}
+	return data.Unmarshal(content)
+}
+
+// Register watches datas so that Pull returns their cached value.
+func (c *Client) Register(datas ...IAcmData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, data := range datas {
+		c.getWatch(data).registered = true
+	}
+}
+
+// Subscribe calls fn with the value of the data type of data each time it
+// changes, and at once when it is known already. The returned function
+// cancels the subscription.
+func (c *Client) Subscribe(data IAcmData, fn func(value interface{})) (cancel func()) {
+	sub := &subscription{fn: fn}
+	c.mu.Lock()
+	w := c.getWatch(data)
+	w.subs = append(w.subs, sub)
+	loaded, value := w.loaded, w.value
+	c.mu.Unlock()
+
+	if loaded {
+		fn(value)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.unsubscribe(data.DataId(), sub) })
+	}
+}
+
+func (c *Client) unsubscribe(dataId string, sub *subscription) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.watches[dataId]
+	if !ok {
+		return
+	}
+	for i, s := range w.subs {
+		if s == sub {
+			w.subs = append(w.subs[:i:i], w.subs[i+1:]...)
+			break
+		}
+	}
+	if len(w.subs) == 0 && !w.registered {
+		w.cancel()
+		delete(c.watches, dataId)
+	}
+}
+
+// Close stops watching the data.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for dataId, w := range c.watches {
+		w.cancel()
+		delete(c.watches, dataId)
+	}
+	return nil
+}
+
+// getWatch returns the watch of data, started on first use. c.mu must be held.
+func (c *Client) getWatch(data IAcmData) *watch {
+	if w, ok := c.watches[data.DataId()]; ok {
+		return w
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watch{data: data, cancel: cancel}
+	c.watches[data.DataId()] = w
+	go c.run(ctx, w)
+	return w
+}
+
+func (c *Client) run(ctx context.Context, w *watch) {
+	if watcher, ok := c.backend.(Watcher); ok && c.watch(ctx, watcher, w) {
+		return
+	}
+
+	for {
+		content, err := c.backend.Get(w.data.DataId())
+		switch err {
+		case nil:
+			c.update(w, content)
+		case ErrNotFound:
+		default:
+			xlog.Error(ctx, "pull acm data failed", zap.String("dataId", w.data.DataId()), zap.Error(err))
+		}
+		timer := time.NewTimer(c.interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// watch applies the contents pushed by the watcher until ctx is done, it
+// returns false when the watch ends first.
+func (c *Client) watch(ctx context.Context, watcher Watcher, w *watch) bool {
+	ch, err := watcher.Watch(ctx, w.data.DataId())
+	if err != nil {
+		xlog.Warn(ctx, "watch acm data failed, fall back to polling", zap.String("dataId", w.data.DataId()), zap.Error(err))
+		return false
+	}
+	for content := range ch {
+		c.update(w, content)
+	}
+	if ctx.Err() == nil {
+		xlog.Warn(ctx, "watch acm data stopped, fall back to polling", zap.String("dataId", w.data.DataId()))
+		return false
+	}
+	return true
+}
+
+// update decodes a new content of w and notifies the subscribers.
+func (c *Client) update(w *watch, content string) {
+	c.mu.Lock()
+	unchanged := w.loaded && w.content == content
+	c.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	value, err := w.data.Unmarshal(content)
+	if err != nil {
+		xlog.Error(context.TODO(), "unmarshal acm data failed", zap.String("dataId", w.data.DataId()), zap.Error(err))
+		return
+	}
+	c.mu.Lock()
+	w.loaded, w.content, w.value = true, content, value
+	subs := make([]*subscription, len(w.subs))
+	copy(subs, w.subs)
+	c.mu.Unlock()
+
+	xlog.Info(context.TODO(), "acm data changed", zap.String("dataId", w.data.DataId()), zap.String("name", w.data.Name()))
+	for _, sub := range subs {
+		sub.fn(value)
+	}
+}
+
+var (
+	defaultClient atomic.Pointer[Client]
+
+	registeredMu sync.Mutex
+	registered   []IAcmData
+)
+
+// SetClient sets the client of the package functions, the data registered
+// with RegisterIAcmData are registered to it.
+func SetClient(c *Client) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	c.Register(registered...)
+	defaultClient.Store(c)
+}
+
+// RegisterIAcmData registers datas to the client of the package, the
+// generated lists of the data of a server can be given as is.
+func RegisterIAcmData(datas ...IAcmData) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, datas...)
+	if c := defaultClient.Load(); c != nil {
+		c.Register(datas...)
+	}
+}
+
+// Push stores data with the client of the package.
+func Push(data IAcmData) error {
+	c := defaultClient.Load()
+	if c == nil {
+		return ErrNoClient
+	}
+	return c.Push(data)
+}
+
+// Pull returns the value of the data type of data with the client of the package.
+func Pull(data IAcmData) (interface{}, error) {
+	c := defaultClient.Load()
+	if c == nil {
+		return nil, ErrNoClient
+	}
+	return c.Pull(data)
+}
+
+// Subscribe calls fn with the value of the data type T, the pointer to a
+// generated message, each time it changes in the client of the package.
+func Subscribe[T IAcmData](fn func(data T)) (cancel func(), err error) {
+	c := defaultClient.Load()
+	if c == nil {
+		return nil, ErrNoClient
+	}
+	return SubscribeClient(c, fn), nil
+}
+
+// SubscribeClient is Subscribe with the client c.
+func SubscribeClient[T IAcmData](c *Client, fn func(data T)) (cancel func()) {
+	var data T
+	return c.Subscribe(data, func(value interface{}) {
+		if v, ok := value.(T); ok {
+			fn(v)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package acm
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type greetConfig struct {
+	Greeting string `json:"greeting"`
+}
+
+func (*greetConfig) DataId() string { return "demo.greet" }
+
+func (*greetConfig) Name() string { return "greet" }
+
+func (x *greetConfig) Marshal() (string, error) {
+	bs, err := json.Marshal(x)
+	return string(bs), err
+}
+
+func (x *greetConfig) Unmarshal(content string) (interface{}, error) {
+	data := &greetConfig{}
+	err := json.Unmarshal([]byte(content), data)
+	return data, err
+}
+
+func testSubscribe(t *testing.T, c *Client) {
+	t.Helper()
+	if _, err := c.Pull(&greetConfig{}); err != ErrNotFound {
+		t.Fatalf("expect not found, got %v", err)
+	}
+
+	ch := make(chan *greetConfig, 4)
+	cancel := SubscribeClient(c, func(data *greetConfig) { ch <- data })
+	defer cancel()
+
+	for _, greeting := range []string{"hello", "hi"} {
+		if err := c.Push(&greetConfig{Greeting: greeting}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case data := <-ch:
+			if data.Greeting != greeting {
+				t.Fatalf("expect %q, got %q", greeting, data.Greeting)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("change to %q not notified", greeting)
+		}
+	}
+	val, err := c.Pull(&greetConfig{})
+	if err != nil || val.(*greetConfig).Greeting != "hi" {
+		t.Fatalf("unexpected pull %v %v", val, err)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	c := NewClient(NewFileBackend(t.TempDir()), WithPollInterval(10*time.Millisecond))
+	defer c.Close()
+	testSubscribe(t, c)
+}
+
+func TestHTTPBackend(t *testing.T) {
+	ts := httptest.NewServer(NewHandler(NewFileBackend(t.TempDir())))
+	defer ts.Close()
+	c := NewClient(NewHTTPBackend(ts.URL))
+	defer c.Close()
+	testSubscribe(t, c)
+}
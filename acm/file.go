@@ -0,0 +1,61 @@
+package acm
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// FileBackend stores each data in a file of Dir named after its data id.
+type FileBackend struct {
+	Dir string
+}
+
+func NewFileBackend(dir string) *FileBackend {
+	return &FileBackend{Dir: dir}
+}
+
+func (b *FileBackend) path(dataId string) (string, error) {
+	switch dataId {
+	case "", ".", "..":
+		return "", fmt.Errorf("invalid data id %q", dataId)
+	}
+	return filepath.Join(b.Dir, url.PathEscape(dataId)), nil
+}
+
+func (b *FileBackend) Get(dataId string) (string, error) {
+	path, err := b.path(dataId)
+	if err != nil {
+		return "", err
+	}
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	return string(bs), err
+}
+
+// Put replaces the file of the data atomically.
+func (b *FileBackend) Put(dataId, content string) error {
+	path, err := b.path(dataId)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(b.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
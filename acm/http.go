@@ -0,0 +1,254 @@
+package acm
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DataPath is the path of the data in the HTTP API of the config center.
+	DataPath = "/acm/data"
+
+	// LongPollTimeout is how long a watch request is held without change.
+	LongPollTimeout = 30 * time.Second
+
+	watchRetryBackoff = time.Second
+	watchMaxBackoff   = 30 * time.Second
+
+	// handlerCheckInterval is the interval at which a held watch request
+	// reads the backend again, for the changes not made through the handler.
+	handlerCheckInterval = time.Second
+)
+
+// HTTPBackend is the client of the HTTP API of a config center served by
+// NewHandler:
+//
+//	GET  DataPath?dataId=id                         returns the content, 404 when unknown
+//	PUT  DataPath?dataId=id                         stores the request body
+//	GET  DataPath?dataId=id&md5=sum&timeout=ms      returns the content once its md5 differs from sum, 304 on timeout
+type HTTPBackend struct {
+	Host   string
+	Client *http.Client
+}
+
+func NewHTTPBackend(host string) *HTTPBackend {
+	return &HTTPBackend{Host: host, Client: &http.Client{}}
+}
+
+func (b *HTTPBackend) url(dataId string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("dataId", dataId)
+	host := b.Host
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host + DataPath + "?" + query.Encode()
+}
+
+func (b *HTTPBackend) Get(dataId string) (string, error) {
+	content, _, err := b.get(context.TODO(), b.url(dataId, nil))
+	return content, err
+}
+
+func (b *HTTPBackend) Put(dataId, content string) error {
+	req, err := http.NewRequest(http.MethodPut, b.url(dataId, nil), strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("put acm data %s: %s %s", dataId, resp.Status, bs)
+	}
+	return nil
+}
+
+// get returns the content at u, changed is false on a watch timeout.
+func (b *HTTPBackend) get(ctx context.Context, u string) (content string, changed bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return string(bs), true, nil
+	case http.StatusNotModified:
+		return "", false, nil
+	case http.StatusNotFound:
+		return "", false, ErrNotFound
+	}
+	return "", false, fmt.Errorf("get acm data: %s %s", resp.Status, bs)
+}
+
+// Watch long polls the content of the data, see HTTPBackend.
+func (b *HTTPBackend) Watch(ctx context.Context, dataId string) (<-chan string, error) {
+	ch := make(chan string, 1)
+	go func() {
+		defer close(ch)
+		var (
+			sum     string
+			backoff = watchRetryBackoff
+		)
+		for {
+			query := url.Values{"md5": {sum}, "timeout": {strconv.FormatInt(LongPollTimeout.Milliseconds(), 10)}}
+			pollCtx, cancel := context.WithTimeout(ctx, LongPollTimeout+5*time.Second)
+			content, changed, err := b.get(pollCtx, b.url(dataId, query))
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff *= 2; backoff > watchMaxBackoff {
+					backoff = watchMaxBackoff
+				}
+				continue
+			}
+			backoff = watchRetryBackoff
+			if !changed {
+				continue
+			}
+			sum = md5sum(content)
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- content:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func md5sum(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewHandler serves the HTTP API of HTTPBackend over backend, e.g. a
+// FileBackend, to make a config center.
+func NewHandler(backend Backend) http.Handler {
+	return &handler{backend: backend, changed: make(map[string]chan struct{})}
+}
+
+type handler struct {
+	backend Backend
+
+	mu sync.Mutex
+	// changed is closed when the data is put through the handler.
+	changed map[string]chan struct{}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dataId := r.URL.Query().Get("dataId")
+	if len(dataId) == 0 {
+		http.Error(w, "dataId required", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, dataId)
+	case http.MethodPut, http.MethodPost:
+		bs, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.backend.Put(dataId, string(bs)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.notify(dataId)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, dataId string) {
+	query := r.URL.Query()
+	watch := query.Has("md5")
+	timeout, _ := strconv.ParseInt(query.Get("timeout"), 10, 64)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Millisecond)
+	for {
+		// the channel is taken before the read so that no change is missed
+		changed := h.changedCh(dataId)
+		content, err := h.backend.Get(dataId)
+		if err != nil && err != ErrNotFound {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case !watch && err == ErrNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case !watch, err == nil && md5sum(content) != query.Get("md5"):
+			io.WriteString(w, content)
+			return
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if wait > handlerCheckInterval {
+			wait = handlerCheckInterval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+func (h *handler) changedCh(dataId string) chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.changed[dataId]
+	if !ok {
+		ch = make(chan struct{})
+		h.changed[dataId] = ch
+	}
+	return ch
+}
+
+func (h *handler) notify(dataId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ch, ok := h.changed[dataId]; ok {
+		close(ch)
+		delete(h.changed, dataId)
+	}
+}
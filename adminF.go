@@ -2,7 +2,6 @@ package microgo
 
 import (
 	"context"
-	"github.com/YCloud160/microgo/config"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
 	"net"
@@ -10,13 +9,12 @@ import (
 	"time"
 )
 
-var adminFServer *http.Server
-
-func initAdminF() {
+func (app *Application) initAdminF() {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/microgo/stop", stopApplication)
+	mux.HandleFunc("/microgo/stop", app.stopApplication)
+	mux.HandleFunc("/microgo/reload", app.reloadConfig)
 	addr := ":0"
-	conf := config.GetConfig()
+	conf := app.Config()
 	if len(conf.AppListen) > 0 {
 		addr = conf.AppListen
 	}
@@ -24,33 +22,27 @@ func initAdminF() {
 	if err != nil {
 		panic(err)
 	}
-	adminFServer = &http.Server{
+	app.adminFServer = &http.Server{
 		Handler: mux,
 	}
 	go func() {
 		xlog.Info(context.TODO(), "adminF start", zap.Any("addr", listen.Addr()))
-		if err := adminFServer.Serve(listen); err != nil {
+		if err := app.adminFServer.Serve(listen); err != nil {
 			xlog.Error(context.TODO(), "adminF stop", zap.Any("addr", listen.Addr()), zap.Error(err))
 		}
 	}()
 }
 
-func stopApplication(writer http.ResponseWriter, request *http.Request) {
-	isClosed.Store(true)
-	if registry != nil {
-		for _, srv := range serverMap {
-			registry.UnRegister(srv.Name(), srv.Addr())
-			xlog.Info(context.TODO(), "unregister server", zap.String("server", srv.Name()))
-		}
-	}
+func (app *Application) stopApplication(writer http.ResponseWriter, request *http.Request) {
+	app.closeRegistration()
 
 	time.Sleep(time.Second * 15)
-	stopCh <- struct{}{}
-	<-stopCh
+	app.stopCh <- struct{}{}
+	<-app.stopCh
 	writer.Write([]byte("stop service success"))
 	go func() {
 		time.Sleep(time.Second)
-		adminFServer.Close()
-		stopCh <- struct{}{}
+		app.adminFServer.Close()
+		app.stopCh <- struct{}{}
 	}()
 }
@@ -2,81 +2,319 @@ package microgo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/internal/gossip"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"os"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
-var (
+// Application runs a set of servers. It holds the configuration, the
+// registry and the discovery used by its servers and clients.
+type Application struct {
+	conf   atomic.Pointer[config.Config]
+	logger *zap.Logger
+	// level is the level of logger unless given by WithLogger, a reload
+	// changes it.
+	level zap.AtomicLevel
+
+	confPath      string
+	confReader    io.Reader
+	confOverrides []string
+
 	startWaitGroup sync.WaitGroup
 
-	serverMap = make(map[string]Server)
-	stopCh    = make(chan struct{})
+	serverMap map[string]Server
+	// stopCh is the stop handshake between stopApplication and loop only,
+	// the background goroutines wait on doneCh, closed once the servers stopped.
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	clientMu  sync.Mutex
+	clientMap map[*Client]struct{}
 
 	isClosed atomic.Bool
-)
 
-func init() {
-	conf := config.GetConfig()
-	xlog.InitXlog(conf)
+	registry Registry
+	// registrationMu serializes the registry operations with the shutdown so
+	// that no server is registered again once it has been unregistered.
+	registrationMu sync.Mutex
+	readinessCheck func() error
+
+	initDiscoveryOnce sync.Once
+	discovery         Discovery
+	discoveryErr      error
+
+	// gossipNodes are the gossip nodes by bind address, shared by the
+	// registry and the discovery.
+	gossipMu    sync.Mutex
+	gossipNodes map[string]*gossip.Node
+
+	adminFServer *http.Server
+
+	reloadMu        sync.Mutex
+	configListeners []func(event *ConfigEvent)
+}
+
+type ApplicationOption func(app *Application)
+
+// WithConfig runs the application with a configuration built in code.
+func WithConfig(conf *config.Config) ApplicationOption {
+	return func(app *Application) {
+		app.conf.Store(conf)
+	}
+}
+
+// WithConfigFile loads the configuration from the yaml file at path.
+func WithConfigFile(path string) ApplicationOption {
+	return func(app *Application) {
+		app.confPath = path
+	}
+}
+
+// WithConfigReader loads the yaml configuration from r.
+func WithConfigReader(r io.Reader) ApplicationOption {
+	return func(app *Application) {
+		app.confReader = r
+	}
+}
 
-	if conf.Registry != nil {
-		initRegistry(conf.Registry)
-		initDiscovery(conf.Registry)
+// WithConfigOverrides applies the path=value overrides to the configuration
+// loaded from a file or a reader, see config.Decode.
+func WithConfigOverrides(overrides ...string) ApplicationOption {
+	return func(app *Application) {
+		app.confOverrides = append(app.confOverrides, overrides...)
 	}
 }
 
+// WithLogger replaces the logger configured by the log settings, the
+// log-level is not applied to it.
+func WithLogger(logger *zap.Logger) ApplicationOption {
+	return func(app *Application) {
+		app.logger = logger
+	}
+}
+
+// NewApplication creates an application, from the defaults when no
+// configuration is given.
+func NewApplication(options ...ApplicationOption) (*Application, error) {
+	app := &Application{
+		level:     zap.NewAtomicLevel(),
+		serverMap: make(map[string]Server),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+		clientMap: make(map[*Client]struct{}),
+	}
+	for _, option := range options {
+		option(app)
+	}
+
+	var (
+		conf = app.conf.Load()
+		err  error
+	)
+	switch {
+	case conf != nil:
+	case len(app.confPath) > 0:
+		conf, err = config.Load(app.confPath, app.confOverrides...)
+	case app.confReader != nil:
+		conf, err = config.Decode(app.confReader, app.confOverrides...)
+	default:
+		conf = &config.Config{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	conf = config.Complete(conf)
+	app.conf.Store(conf)
+
+	if err := xlog.UpdateLevel(app.level, conf.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if app.logger == nil {
+		app.logger = xlog.NewLevelLogger(conf, app.level)
+	}
+	return app, nil
+}
+
+var (
+	initDefaultOnce sync.Once
+	defaultApp      *Application
+	defaultAppErr   error
+)
+
+// DefaultApplication returns the application of the package functions, it
+// uses the configuration of config.Current, loaded from the -config flag on
+// first use. When it cannot be loaded the defaults are used and Run fails.
+// The package log functions write to its logger.
+func DefaultApplication() *Application {
+	initDefaultOnce.Do(func() {
+		conf, err := config.Current()
+		if err != nil {
+			defaultAppErr = err
+			conf = &config.Config{}
+		}
+		defaultApp, _ = NewApplication(WithConfig(conf))
+		xlog.SetLogger(defaultApp.logger)
+	})
+	return defaultApp
+}
+
+// Config returns the configuration of the application, a reload replaces it.
+func (app *Application) Config() *config.Config {
+	return app.conf.Load()
+}
+
+// Logger returns the logger of the application.
+func (app *Application) Logger() *zap.Logger {
+	return app.logger
+}
+
+// appServer is implemented by the servers of the package, which take their
+// configuration from the application they are registered to.
+type appServer interface {
+	bind(app *Application)
+	reloadConfig(conf *config.ServerConfig)
+}
+
 func RegisterServer(servers ...Server) {
+	DefaultApplication().RegisterServer(servers...)
+}
+
+func (app *Application) RegisterServer(servers ...Server) {
 	for _, s := range servers {
-		serverMap[s.Name()] = s
+		if as, ok := s.(appServer); ok {
+			as.bind(app)
+		}
+		app.serverMap[s.Name()] = s
+	}
+}
+
+func (app *Application) addClient(client *Client) {
+	app.clientMu.Lock()
+	app.clientMap[client] = struct{}{}
+	app.clientMu.Unlock()
+}
+
+func (app *Application) removeClient(client *Client) {
+	app.clientMu.Lock()
+	delete(app.clientMap, client)
+	app.clientMu.Unlock()
+}
+
+func (app *Application) closeClients() {
+	app.clientMu.Lock()
+	clients := make([]*Client, 0, len(app.clientMap))
+	for client := range app.clientMap {
+		clients = append(clients, client)
+	}
+	app.clientMu.Unlock()
+
+	for _, client := range clients {
+		client.Close()
 	}
 }
 
+// Run runs the default application.
 func Run() error {
-	initAdminF()
+	app := DefaultApplication()
+	if defaultAppErr != nil {
+		return defaultAppErr
+	}
+	return app.Run()
+}
 
-	for _, server := range serverMap {
-		startWaitGroup.Add(1)
+func (app *Application) Run() error {
+	if err := app.validate(); err != nil {
+		return err
+	}
+	if err := app.initRegistry(); err != nil {
+		return err
+	}
+	if _, err := app.getDiscovery(); err != nil {
+		return err
+	}
+
+	app.initAdminF()
+
+	for _, server := range app.serverMap {
+		app.startWaitGroup.Add(1)
+		if _, ok := server.(appServer); !ok {
+			app.startWaitGroup.Done()
+		}
 		go func(server Server) {
 			if err := server.Start(); err != nil {
 				xlog.Error(context.TODO(), "server start failed", zap.String("server", server.Name()), zap.Error(err))
 			}
 		}(server)
 	}
-	startWaitGroup.Wait()
+	app.startWaitGroup.Wait()
+
+	go app.maintainRegistration()
+	go app.watchConfig()
 
-	if registry != nil {
-		for _, srv := range serverMap {
-			registry.Register(srv.Name(), srv.Addr())
-			xlog.Info(context.TODO(), "register server", zap.String("server", srv.Name()))
+	return app.loop()
+}
+
+// validate reports in one error the bad settings of the configuration, the
+// unknown registries and the servers without configuration.
+func (app *Application) validate() error {
+	conf := app.Config()
+	errs := &config.ValidationError{}
+	var ve *config.ValidationError
+	if err := config.Validate(conf); errors.As(err, &ve) {
+		errs.Errors = append(errs.Errors, ve.Errors...)
+	}
+
+	builderMu.Lock()
+	if conf.Registry != nil && len(conf.Registry.Name) > 0 {
+		if _, ok := registryBuilders[conf.Registry.Name]; !ok {
+			errs.Add("registry.name", "unknown registry %q", conf.Registry.Name)
+		}
+	}
+	for i, rc := range conf.Registries {
+		if _, ok := registryBuilders[rc.Name]; !ok && len(rc.Name) > 0 {
+			errs.Add(fmt.Sprintf("registries[%d].name", i), "unknown registry %q", rc.Name)
+		}
+	}
+	if dc := conf.Discovery; dc != nil && len(dc.Name) > 0 {
+		if _, ok := discoveryBuilders[dc.Name]; !ok {
+			errs.Add("discovery.name", "unknown discovery %q", dc.Name)
 		}
 	}
+	builderMu.Unlock()
 
-	return loop()
+	for name, srv := range app.serverMap {
+		if _, ok := srv.(appServer); !ok {
+			continue
+		}
+		if _, ok := conf.LookupServerConfig(name); !ok {
+			errs.Add("server["+name+"]", "not configured")
+		}
+	}
+	return errs.Err()
 }
 
-func loop() error {
-	conf := config.GetConfig()
-	tick := time.NewTicker(time.Duration(conf.KeepAlive) * time.Millisecond)
+func (app *Application) loop() error {
 	for {
 		select {
-		case <-tick.C:
-			if isClosed.Load() == false && registry != nil {
-				for _, srv := range serverMap {
-					registry.KeepAlive(srv.Name(), srv.Addr())
-					xlog.Info(context.TODO(), "keepAlive", zap.String("server", srv.Name()))
-				}
-			}
-		case <-stopCh:
-			for _, srv := range serverMap {
+		case <-app.stopCh:
+			app.closeRegistration()
+			for _, srv := range app.serverMap {
 				srv.Stop()
 			}
+			app.closeClients()
+			app.closeGossipNodes()
+			close(app.doneCh)
 			xlog.Info(context.TODO(), "stop service success")
-			stopCh <- struct{}{}
-			<-stopCh
+			app.stopCh <- struct{}{}
+			<-app.stopCh
 			return nil
 		}
 	}
@@ -0,0 +1,193 @@
+package microgo_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo"
+	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/example/rpcserver/handle"
+	"github.com/YCloud160/microgo/example/rpcserver/model"
+	"go.uber.org/zap/zapcore"
+)
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestApplication(t *testing.T) {
+	port := freePort(t)
+	app, err := microgo.NewApplication(microgo.WithConfigReader(strings.NewReader(`
+service: demo
+app-listen: 127.0.0.1:0
+local-ip: 127.0.0.1
+server:
+  - name: demo.rpcServer
+    port: "` + port + `"
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.RegisterServer(microgo.NewTCPServer("demo.rpcServer", &handle.HelloServer{}, model.GreetObjCall))
+	go app.Run()
+
+	client := app.NewClient("demo.rpcServer", microgo.WithClientOptionHosts("127.0.0.1:"+port))
+	defer client.Close()
+
+	var (
+		resp = &model.SayHelloResp{}
+		last error
+	)
+	for i := 0; i < 50; i++ {
+		if last = client.Invoke(context.Background(), "SayHello", &model.SayHelloReq{Name: "microgo"}, resp); last == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if last != nil {
+		t.Fatal(last)
+	}
+	if resp.Message != "hello microgo" {
+		t.Fatalf("unexpected message %q", resp.Message)
+	}
+}
+
+func TestApplicationConfigInCode(t *testing.T) {
+	conf := &config.Config{Service: "demo", Registry: &config.Registry{Name: "unknown"}}
+	app, err := microgo.NewApplication(microgo.WithConfig(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Config().KeepAlive == 0 || app.Config().ClientConf == nil {
+		t.Fatal("config not completed")
+	}
+	if err := app.Run(); err == nil || !strings.Contains(err.Error(), "unknown registry") {
+		t.Fatalf("expect unknown registry error, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(logLevel, maxInvoke, port string) {
+		conf := "log-level: " + logLevel + "\nserver:\n  - name: demo.rpcServer\n    port: \"" + port + "\"\n    max-invoke: " + maxInvoke + "\n"
+		if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("info", "10", "8080")
+
+	app, err := microgo.NewApplication(microgo.WithConfigFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := microgo.NewApplication(microgo.WithConfigReader(strings.NewReader("log-level: info\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.RegisterServer(microgo.NewTCPServer("demo.rpcServer", &handle.HelloServer{}, model.GreetObjCall))
+	var events []*microgo.ConfigEvent
+	app.OnConfigChange(func(event *microgo.ConfigEvent) {
+		events = append(events, event)
+	})
+
+	write("warn", "20", "9090")
+	event, err := app.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event.Applied, []string{"log-level", "server[demo.rpcServer].max-invoke"}) {
+		t.Fatalf("unexpected applied fields %v", event.Applied)
+	}
+	if !reflect.DeepEqual(event.RestartRequired, []string{"server[demo.rpcServer].port"}) {
+		t.Fatalf("unexpected restart required fields %v", event.RestartRequired)
+	}
+	srvConf := app.Config().GetServerConfig("demo.rpcServer")
+	if srvConf.MaxInvoke != 20 || srvConf.Port != "8080" || app.Config().LogLevel != "warn" {
+		t.Fatalf("unexpected config after reload %+v", srvConf)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expect 1 event, got %d", len(events))
+	}
+	if app.Logger().Core().Enabled(zapcore.InfoLevel) || !other.Logger().Core().Enabled(zapcore.InfoLevel) {
+		t.Fatal("expect the log level reloaded for the application only")
+	}
+
+	write("loud", "20", "9090")
+	if _, err := app.Reload(); err == nil {
+		t.Fatal("expect invalid log level error")
+	}
+}
+
+func TestReloadClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(requestTimeout, poolSize string) {
+		conf := "client:\n  request-timeout: " + requestTimeout + "\nclients:\n  demo.rpcServer:\n    pool-size: " + poolSize + "\n"
+		if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("3000", "2")
+
+	app, err := microgo.NewApplication(microgo.WithConfigFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("4000", "3")
+	event, err := app.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event.Applied, []string{"client.request-timeout", "clients[demo.rpcServer].request-timeout"}) {
+		t.Fatalf("unexpected applied fields %v", event.Applied)
+	}
+	if !reflect.DeepEqual(event.RestartRequired, []string{"clients[demo.rpcServer].pool-size"}) {
+		t.Fatalf("unexpected restart required fields %v", event.RestartRequired)
+	}
+	clientConf := app.Config().GetClientConfig("demo.rpcServer")
+	if clientConf.RequestTimeout != int64(4*time.Second) || clientConf.PoolSize != 2 {
+		t.Fatalf("unexpected client config after reload %+v", clientConf)
+	}
+}
+
+func TestReloadFromListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("log-level: info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app, err := microgo.NewApplication(microgo.WithConfigFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	app.OnConfigChange(func(event *microgo.ConfigEvent) {
+		app.OnConfigChange(func(event *microgo.ConfigEvent) {})
+		if _, err := app.Reload(); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	})
+
+	if err := os.WriteFile(path, []byte("log-level: warn\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	go app.Reload()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("reload from a listener deadlocked")
+	}
+}
@@ -0,0 +1,122 @@
+package microgo
+
+import (
+	"net"
+	"time"
+)
+
+type CallOption func(opts *callOptions)
+
+type callOptions struct {
+	host        string
+	timeout     time.Duration
+	contentType string
+	meta        map[string]string
+	retry       *RetryPolicy
+	routingKey  string
+	header      *map[string]string
+	trailer     *map[string]string
+}
+
+func (client *Client) newCallOptions(options ...CallOption) *callOptions {
+	conf := client.clientConfig()
+	opts := &callOptions{
+		timeout: time.Duration(conf.RequestTimeout),
+	}
+	if conf.Retry != nil && conf.Retry.MaxAttempts > 1 {
+		opts.retry = &RetryPolicy{MaxAttempts: int(conf.Retry.MaxAttempts), Backoff: time.Duration(conf.Retry.Backoff)}
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// WithCallHost sends the call to the given host, it must be one of the client hosts.
+func WithCallHost(host string) CallOption {
+	return func(opts *callOptions) {
+		opts.host = host
+	}
+}
+
+// WithCallTimeout overrides the request-timeout of the client for one call.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(opts *callOptions) {
+		if timeout > 0 {
+			opts.timeout = timeout
+		}
+	}
+}
+
+// WithCallContentType sets the encoder used for the call, see RegisterEncoder.
+func WithCallContentType(contentType string) CallOption {
+	return func(opts *callOptions) {
+		opts.contentType = contentType
+	}
+}
+
+// WithCallMeta adds metadata headers to the call.
+func WithCallMeta(meta map[string]string) CallOption {
+	return func(opts *callOptions) {
+		if opts.meta == nil {
+			opts.meta = make(map[string]string, len(meta))
+		}
+		for k, v := range meta {
+			opts.meta[k] = v
+		}
+	}
+}
+
+// WithCallRetry retries the call on other hosts according to the policy.
+func WithCallRetry(policy *RetryPolicy) CallOption {
+	return func(opts *callOptions) {
+		opts.retry = policy
+	}
+}
+
+// WithCallRoutingKey sends all calls with the same key to the same host.
+func WithCallRoutingKey(key string) CallOption {
+	return func(opts *callOptions) {
+		opts.routingKey = key
+	}
+}
+
+// WithCallHeader stores the response headers set by the server into md.
+func WithCallHeader(md *map[string]string) CallOption {
+	return func(opts *callOptions) {
+		opts.header = md
+	}
+}
+
+// WithCallTrailer stores the response trailers set by the server into md.
+func WithCallTrailer(md *map[string]string) CallOption {
+	return func(opts *callOptions) {
+		opts.trailer = md
+	}
+}
+
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// Backoff is the wait between two attempts.
+	Backoff time.Duration
+	// RetryOn reports whether the error should be retried, IsRetryable by default.
+	RetryOn func(err error) bool
+}
+
+func (policy *RetryPolicy) retryable(err error) bool {
+	if policy.RetryOn != nil {
+		return policy.RetryOn(err)
+	}
+	return IsRetryable(err)
+}
+
+// IsRetryable reports whether the call failed before the server could handle it.
+func IsRetryable(err error) bool {
+	switch err {
+	case ErrBadConnection, ErrNotFoundConnection, ErrConnectionLost, ErrConnectionBusy, ErrConnPoolClosed:
+		return true
+	}
+	_, ok := err.(*net.OpError)
+	return ok
+}
@@ -2,14 +2,22 @@ package microgo
 
 import (
 	"context"
+	"fmt"
 	"github.com/YCloud160/microgo/config"
 	"github.com/YCloud160/microgo/errors"
 	"github.com/YCloud160/microgo/internal/generator"
 	"github.com/YCloud160/microgo/meta"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/encoder"
 	"github.com/YCloud160/microgo/utils/header"
+	"github.com/YCloud160/microgo/utils/tracer"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
+	"hash/fnv"
+	"math/rand"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,46 +41,167 @@ func WithClientOptionHosts(hosts ...string) ClientOption {
 	}
 }
 
+var ErrClientClosed = fmt.Errorf("client closed")
+
 type Client struct {
+	app   *Application
 	name  string
 	mu    sync.Mutex
-	conf  *config.ClientConfig
+	conf  atomic.Pointer[config.ClientConfig]
 	idx   int
 	hosts []string
 	pool  map[string]*clientConnPool
-	reqCh sync.Map
+
+	localZone   string
+	instances   map[string]*naming.Instance
+	unhealthy   map[string]time.Time
+	failures    map[string]int64
+	emptyRoutes int64
+	// recheck re-queries the discovery to confirm an ignored empty route
+	// table, watchers push again only when the instances change.
+	recheck *time.Timer
+	// cacheSignature is the naming.Signature of the instances last saved to
+	// the route cache.
+	cacheSignature string
+
+	discovery Discovery
+	stopCh    chan struct{}
+	isClosed  atomic.Bool
 }
 
+// NewClient creates a client of the default application.
 func NewClient(name string, options ...ClientOption) *Client {
+	return DefaultApplication().NewClient(name, options...)
+}
+
+// NewClient creates a client of the service name, configured by the clients
+// entry of name or else the client block. Its hosts come from the discovery
+// of the application unless given as options or as static hosts.
+func (app *Application) NewClient(name string, options ...ClientOption) *Client {
 	client := &Client{
-		name:  name,
-		conf:  config.GetClientConfig(),
-		hosts: make([]string, 0),
-		pool:  make(map[string]*clientConnPool),
+		app:    app,
+		name:   name,
+		hosts:  make([]string, 0),
+		pool:   make(map[string]*clientConnPool),
+		stopCh: make(chan struct{}),
+
+		localZone: app.Config().LocalZone,
+		instances: make(map[string]*naming.Instance),
+		unhealthy: make(map[string]time.Time),
+		failures:  make(map[string]int64),
+	}
+
+	conf := app.Config().GetClientConfig(name)
+	client.conf.Store(conf)
+	if len(conf.Hosts) > 0 {
+		WithClientOptionHosts(conf.Hosts...)(client)
 	}
 
 	for _, option := range options {
 		option(client)
 	}
 
+	if len(conf.Hosts) > 0 {
+		app.addClient(client)
+		return client
+	}
+
+	discovery, err := app.getDiscovery()
+	if err != nil {
+		xlog.Error(context.TODO(), "init discovery failed", zap.String("name", name), zap.Error(err))
+	}
+	client.discovery = discovery
+
 	if discovery != nil {
-		hosts, err := discovery.QueryRoute(name)
+		instances, err := discovery.QueryRoute(name)
+		if err != nil {
+			xlog.Error(context.TODO(), "query route failed, load route cache", zap.String("name", name), zap.Error(err))
+			if instances, err = loadRouteCache(app.Config().BaseDir, name); err != nil && !os.IsNotExist(err) {
+				xlog.Error(context.TODO(), "load route cache failed", zap.String("name", name), zap.Error(err))
+			}
+		} else {
+			client.saveRouteCache(instances)
+		}
+		hosts := naming.Addrs(instances)
 		xlog.Info(context.TODO(), "节点", zap.Strings("hosts", hosts))
-		if err == nil && len(hosts) > 0 {
+		if len(hosts) > 0 {
 			WithClientOptionHosts(hosts...)(client)
+			client.setInstances(instances)
 		}
 		go client.updateNode()
 	}
 
+	app.addClient(client)
 	return client
 }
 
+func (client *Client) clientConfig() *config.ClientConfig {
+	return client.conf.Load()
+}
+
+// Close stops the endpoint refresh and closes every connection, the calls
+// in flight and the following ones fail with ErrClientClosed.
+func (client *Client) Close() error {
+	if client.isClosed.Swap(true) {
+		return nil
+	}
+	close(client.stopCh)
+	client.app.removeClient(client)
+
+	client.mu.Lock()
+	if client.recheck != nil {
+		client.recheck.Stop()
+		client.recheck = nil
+	}
+	pools := client.pool
+	client.pool = make(map[string]*clientConnPool)
+	client.mu.Unlock()
+
+	for _, p := range pools {
+		p.shutdown()
+	}
+	return nil
+}
+
 func (client *Client) updateNode() {
-	tick := time.NewTicker(time.Second * time.Duration(client.conf.RefreshEndpointInterval))
+	if watcher, ok := client.discovery.(Watcher); ok && client.watchNode(watcher) {
+		return
+	}
+
+	// the interval is read again at each refresh as a reload may change it
 	for {
+		timer := time.NewTimer(time.Millisecond * time.Duration(client.clientConfig().RefreshEndpointInterval))
 		select {
-		case <-tick.C:
+		case <-timer.C:
 			client._updateNode()
+		case <-client.stopCh:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// watchNode applies the instances pushed by the watcher until the client is
+// closed, it returns false when the watch ends first.
+func (client *Client) watchNode(watcher Watcher) bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := watcher.Watch(ctx, client.name)
+	if err != nil {
+		xlog.Warn(ctx, "watch endpoint failed, fall back to polling", zap.String("name", client.name), zap.Error(err))
+		return false
+	}
+	for {
+		select {
+		case instances, ok := <-ch:
+			if !ok {
+				xlog.Warn(ctx, "watch endpoint stopped, fall back to polling", zap.String("name", client.name))
+				return false
+			}
+			client.updateInstances(instances)
+		case <-client.stopCh:
+			return true
 		}
 	}
 }
@@ -80,10 +209,49 @@ func (client *Client) updateNode() {
 func (client *Client) _updateNode() {
 	defer xlog.Recover(context.TODO())
 
-	hosts, err := discovery.QueryRoute(client.name)
+	instances, err := client.discovery.QueryRoute(client.name)
 	if err != nil {
 		return
 	}
+	client.updateInstances(instances)
+}
+
+// recheckRoute queries the discovery again after an ignored empty route table.
+func (client *Client) recheckRoute() {
+	client.mu.Lock()
+	client.recheck = nil
+	client.mu.Unlock()
+	if client.isClosed.Load() {
+		return
+	}
+	client._updateNode()
+}
+
+// updateInstances applies the route table from the discovery. An empty table
+// only clears the hosts once confirmed by empty-route-threshold refreshes in
+// a row, the discovery being queried again each refresh-endpoint-interval
+// until then. A non-empty one is saved to the route cache.
+func (client *Client) updateInstances(instances []*naming.Instance) {
+	hosts := naming.Addrs(instances)
+	client.mu.Lock()
+	if len(hosts) > 0 {
+		client.emptyRoutes = 0
+	} else if len(client.hosts) > 0 {
+		client.emptyRoutes++
+		if client.emptyRoutes < client.clientConfig().EmptyRouteThreshold {
+			if client.recheck == nil && !client.isClosed.Load() {
+				interval := time.Millisecond * time.Duration(client.clientConfig().RefreshEndpointInterval)
+				client.recheck = time.AfterFunc(interval, client.recheckRoute)
+			}
+			times := client.emptyRoutes
+			client.mu.Unlock()
+			xlog.Warn(context.TODO(), "empty route ignored", zap.String("name", client.name), zap.Int64("times", times))
+			return
+		}
+	}
+	client.mu.Unlock()
+	client.saveRouteCache(instances)
+
 	var (
 		oldHost     = make(map[string]struct{})
 		delHost     = make(map[string]struct{})
@@ -118,9 +286,13 @@ func (client *Client) _updateNode() {
 
 	var delPool []*clientConnPool
 
+	client.setInstances(instances)
+
 	client.mu.Lock()
 	client.hosts = newHostList
 	for h := range delHost {
+		delete(client.unhealthy, h)
+		delete(client.failures, h)
 		if p, ok := client.pool[h]; ok {
 			delPool = append(delPool, p)
 			delete(client.pool, h)
@@ -133,38 +305,108 @@ func (client *Client) _updateNode() {
 	}
 }
 
-func (client *Client) handle(msg *Message) {
-	val, ok := client.reqCh.Load(msg.Data.RequestId)
-	if ok {
-		if reqCh, reqOk := val.(chan *Message); reqOk {
-			reqCh <- msg
-		}
+// saveRouteCache saves the instances to the route cache unless they are the
+// ones saved last.
+func (client *Client) saveRouteCache(instances []*naming.Instance) {
+	sig := naming.Signature(instances)
+	client.mu.Lock()
+	unchanged := sig == client.cacheSignature
+	client.mu.Unlock()
+	if unchanged {
+		return
+	}
+	if err := saveRouteCache(client.app.Config().BaseDir, client.name, instances); err != nil {
+		xlog.Error(context.TODO(), "save route cache failed", zap.String("name", client.name), zap.Error(err))
+		return
 	}
+	client.mu.Lock()
+	client.cacheSignature = sig
+	client.mu.Unlock()
 }
 
-func (client *Client) Call(ctx context.Context, host, contentType, method string, input []byte) (out []byte, err error) {
-	return client.call(ctx, host, contentType, method, input)
+func (client *Client) Call(ctx context.Context, host, contentType, method string, input []byte, options ...CallOption) (out []byte, err error) {
+	opts := client.newCallOptions(options...)
+	if len(opts.host) == 0 {
+		opts.host = host
+	}
+	if len(opts.contentType) == 0 {
+		opts.contentType = contentType
+	}
+	return client.invoke(ctx, method, input, opts)
 }
 
-func (client *Client) BroadcastCall(ctx context.Context, contentType, method string, input []byte) (map[string][]byte, map[string]error) {
-	hosts := client.getActiveHosts()
-	var (
-		outs = make(map[string][]byte)
-		errs = make(map[string]error)
-	)
-	for _, host := range hosts {
-		out, err := client.call(ctx, host, contentType, method, input)
-		outs[host] = out
-		errs[host] = err
+// Invoke encodes req with the encoder of the call content type, proto by default,
+// calls the method and decodes the output into resp.
+func (client *Client) Invoke(ctx context.Context, method string, req, resp any, options ...CallOption) error {
+	opts := client.newCallOptions(options...)
+	if len(opts.contentType) == 0 {
+		opts.contentType = encoder.ProtoEncoder
+	}
+	enc := GetEncoder(opts.contentType)
+	input, err := enc.Marshal(req)
+	if err != nil {
+		return err
+	}
+	out, err := client.invoke(ctx, method, input, opts)
+	if err != nil {
+		return err
+	}
+	return enc.Unmarshal(out, resp)
+}
+
+func (client *Client) invoke(ctx context.Context, method string, input []byte, opts *callOptions) (out []byte, err error) {
+	if client.isClosed.Load() {
+		return nil, ErrClientClosed
+	}
+	attempts := 1
+	if opts.retry != nil && opts.retry.MaxAttempts > 1 {
+		attempts = opts.retry.MaxAttempts
+	}
+	tried := make(map[string]struct{}, attempts)
+	for i := 0; i < attempts; i++ {
+		if i > 0 && opts.retry.Backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(opts.retry.Backoff):
+			}
+		}
+		host := opts.host
+		if len(host) == 0 {
+			if host, err = client.selectHost(opts.routingKey, tried); err != nil {
+				return nil, err
+			}
+		}
+		tried[host] = struct{}{}
+
+		out, err = client.call(ctx, host, method, input, opts)
+		client.reportHost(host, err)
+		if err == nil || opts.retry == nil || !opts.retry.retryable(err) {
+			return out, err
+		}
 	}
-	return outs, errs
+	return out, err
 }
 
-func (client *Client) call(ctx context.Context, host, contentType, method string, input []byte) (out []byte, err error) {
-	meta, _ := meta.FromOutContext(ctx)
-	meta[header.ContentType] = contentType
+func (client *Client) call(ctx context.Context, host, method string, input []byte, opts *callOptions) (out []byte, err error) {
+	defer func() {
+		if err != nil && client.isClosed.Load() {
+			out, err = nil, ErrClientClosed
+		}
+	}()
 
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(client.conf.RequestTimeout))
+	reqMeta, _ := meta.FromOutgoingContext(ctx)
+	for k, v := range opts.meta {
+		reqMeta[k] = v
+	}
+	if _, ok := reqMeta[header.Tracer]; !ok {
+		if trace := tracer.FromContext(ctx); trace != nil {
+			reqMeta[header.Tracer] = trace.String()
+		}
+	}
+	reqMeta[header.ContentType] = opts.contentType
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
 	defer cancel()
 
 	req := getMessage()
@@ -174,7 +416,7 @@ func (client *Client) call(ctx context.Context, host, contentType, method string
 	req.Data.RequestId = reqId
 	req.Data.Obj = client.name
 	req.Data.Method = method
-	req.Data.Meta = meta
+	req.Data.Meta = reqMeta
 	req.Data.Body = input
 
 	var respChan = make(chan *Message, 1)
@@ -184,8 +426,10 @@ func (client *Client) call(ctx context.Context, host, contentType, method string
 		return nil, err
 	}
 
-	client.reqCh.Store(reqId, respChan)
-	defer client.reqCh.Delete(reqId)
+	if !rw.addPending(reqId, respChan) {
+		return nil, ErrConnectionLost
+	}
+	defer rw.removePending(reqId)
 
 	if err := rw.sendMessage(req); err != nil {
 		return nil, err
@@ -202,35 +446,36 @@ func (client *Client) call(ctx context.Context, host, contentType, method string
 	case resp, ok = <-respChan:
 		if ok {
 			out = resp.Data.Body
+			if opts.header != nil || opts.trailer != nil {
+				respHeader, respTrailer := meta.SplitResponse(resp.Data.Meta)
+				if opts.header != nil {
+					*opts.header = respHeader
+				}
+				if opts.trailer != nil {
+					*opts.trailer = respTrailer
+				}
+			}
 			if resp.Data.Code != 0 {
 				err = errors.New("", resp.Data.Desc, resp.Data.Code)
 			}
 			putMessage(resp)
 			return out, err
 		}
+		return nil, ErrConnectionLost
 	}
 
 	return nil, errors.New("", "request timeout", 9999)
 }
 
 func (client *Client) getActiveHosts() []string {
-	var hosts []string
 	client.mu.Lock()
-	for host := range client.pool {
-		hosts = append(hosts, host)
-	}
+	hosts := make([]string, len(client.hosts))
+	copy(hosts, client.hosts)
 	client.mu.Unlock()
 	return hosts
 }
 
 func (client *Client) getConn(host string) (*conn, error) {
-	if len(host) > 0 {
-		return client.getTargetConn(host)
-	}
-	return client.getRingConn()
-}
-
-func (client *Client) getTargetConn(host string) (*conn, error) {
 	client.mu.Lock()
 
 	exist := false
@@ -249,28 +494,66 @@ func (client *Client) getTargetConn(host string) (*conn, error) {
 	return nil, ErrNotFoundConnection
 }
 
-func (client *Client) getRingConn() (*conn, error) {
+// selectHost picks the host of the next call, hosts in exclude are skipped
+// unless no other host is left. A routing key always maps to the same host
+// while the host list is unchanged.
+func (client *Client) selectHost(routingKey string, exclude map[string]struct{}) (string, error) {
 	client.mu.Lock()
+	defer client.mu.Unlock()
 
-	if len(client.hosts) == 0 {
-		return nil, ErrNotFoundConnection
+	hosts := client.hosts
+	if len(exclude) > 0 {
+		hosts = make([]string, 0, len(client.hosts))
+		for _, host := range client.hosts {
+			if _, ok := exclude[host]; !ok {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) == 0 {
+			hosts = client.hosts
+		}
+	}
+	if len(hosts) == 0 {
+		return "", ErrNotFoundConnection
+	}
+	hosts = client.routableHosts(hosts)
+
+	if len(routingKey) > 0 {
+		var (
+			host     string
+			maxScore uint64
+		)
+		for _, h := range hosts {
+			hash := fnv.New64a()
+			hash.Write([]byte(routingKey))
+			hash.Write([]byte(h))
+			if score := hash.Sum64(); len(host) == 0 || score > maxScore {
+				host, maxScore = h, score
+			}
+		}
+		return host, nil
 	}
 
-	if client.idx >= len(client.hosts) {
+	if client.clientConfig().Balancer == config.BalancerRandom {
+		return hosts[rand.Intn(len(hosts))], nil
+	}
+	if client.idx >= len(hosts) {
 		client.idx = 0
 	}
-	host := client.hosts[client.idx]
+	host := hosts[client.idx]
 	client.idx++
-	client.mu.Unlock()
-
-	return client._getConn(host)
+	return host, nil
 }
 
 func (client *Client) _getConn(host string) (*conn, error) {
 	client.mu.Lock()
+	if client.isClosed.Load() {
+		client.mu.Unlock()
+		return nil, ErrClientClosed
+	}
 	pool, ok := client.pool[host]
 	if !ok {
-		pool = newClientConnPool(client, host, 0)
+		pool = newClientConnPool(client, host)
 		client.pool[host] = pool
 	}
 	client.mu.Unlock()
@@ -0,0 +1,86 @@
+package microgo
+
+import (
+	"context"
+	"fmt"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+)
+
+// TypedFuture is the pending result of an asynchronous call.
+type TypedFuture[T any] struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	resp   T
+	err    error
+}
+
+// Future is the pending result of an asynchronous raw call.
+type Future = TypedFuture[[]byte]
+
+// Done is closed when the call completes.
+func (f *TypedFuture[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the call completes and returns its result.
+func (f *TypedFuture[T]) Wait() (T, error) {
+	<-f.done
+	return f.resp, f.err
+}
+
+// Cancel aborts the call, Wait returns context.Canceled unless the call has already completed.
+func (f *TypedFuture[T]) Cancel() {
+	f.cancel()
+}
+
+// Async runs call in the background and returns its future. callback may be nil,
+// otherwise it is invoked with the result once the call completes.
+func Async[T any](ctx context.Context, call func(ctx context.Context) (T, error), callback func(resp T, err error)) *TypedFuture[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &TypedFuture[T]{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	go func() {
+		defer cancel()
+
+		var (
+			resp T
+			err  error
+		)
+		// the future completes on every path, a panic of call is its error
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					err = fmt.Errorf("async call panic: %v", e)
+					xlog.Error(ctx, "async call panic", zap.Any("error", e))
+				}
+				f.resp, f.err = resp, err
+				close(f.done)
+			}()
+			resp, err = call(ctx)
+			if err != nil && ctx.Err() == context.Canceled {
+				err = ctx.Err()
+			}
+		}()
+
+		if callback != nil {
+			defer xlog.Recover(ctx)
+			callback(resp, err)
+		}
+	}()
+	return f
+}
+
+// Go starts the call without blocking and returns its future.
+func (client *Client) Go(ctx context.Context, host, contentType, method string, input []byte) *Future {
+	return client.CallAsync(ctx, host, contentType, method, input, nil)
+}
+
+// CallAsync starts the call without blocking, callback is invoked with the result.
+func (client *Client) CallAsync(ctx context.Context, host, contentType, method string, input []byte, callback func(out []byte, err error)) *Future {
+	return Async(ctx, func(ctx context.Context) ([]byte, error) {
+		return client.Call(ctx, host, contentType, method, input)
+	}, callback)
+}
@@ -0,0 +1,31 @@
+package microgo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo"
+)
+
+func TestAsyncPanic(t *testing.T) {
+	called := make(chan error, 1)
+	f := microgo.Async(context.Background(), func(ctx context.Context) (string, error) {
+		panic("codec failed")
+	}, func(resp string, err error) {
+		called <- err
+	})
+
+	select {
+	case <-f.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("future not done after a panic")
+	}
+	if _, err := f.Wait(); err == nil || !strings.Contains(err.Error(), "codec failed") {
+		t.Fatalf("expect the panic as error, got %v", err)
+	}
+	if err := <-called; err == nil {
+		t.Fatal("expect the callback called with the panic error")
+	}
+}
@@ -0,0 +1,136 @@
+package microgo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var ErrBroadcastQuorum = fmt.Errorf("broadcast quorum not reached")
+
+// BroadcastResult is the outcome of a broadcast call on a single host.
+type BroadcastResult struct {
+	Host    string
+	Out     []byte
+	Err     error
+	Latency time.Duration
+}
+
+// BroadcastReply is the typed form of BroadcastResult used by generated clients.
+type BroadcastReply[T any] struct {
+	Host    string
+	Resp    T
+	Err     error
+	Latency time.Duration
+}
+
+type BroadcastOption func(opts *broadcastOptions)
+
+type broadcastOptions struct {
+	concurrency int
+	timeout     time.Duration
+	quorum      int
+}
+
+// WithBroadcastConcurrency limits how many hosts are called at the same time.
+func WithBroadcastConcurrency(n int) BroadcastOption {
+	return func(opts *broadcastOptions) {
+		if n > 0 {
+			opts.concurrency = n
+		}
+	}
+}
+
+// WithBroadcastTimeout sets the timeout of the call on each host.
+func WithBroadcastTimeout(timeout time.Duration) BroadcastOption {
+	return func(opts *broadcastOptions) {
+		if timeout > 0 {
+			opts.timeout = timeout
+		}
+	}
+}
+
+// WithBroadcastQuorum makes BroadcastCall return as soon as n hosts succeed,
+// the calls still in flight are canceled.
+func WithBroadcastQuorum(n int) BroadcastOption {
+	return func(opts *broadcastOptions) {
+		if n > 0 {
+			opts.quorum = n
+		}
+	}
+}
+
+// BroadcastCall calls the method on every known host concurrently.
+// The results are in completion order. With a quorum the error is
+// ErrBroadcastQuorum when not enough hosts succeed.
+func (client *Client) BroadcastCall(ctx context.Context, contentType, method string, input []byte, options ...BroadcastOption) ([]*BroadcastResult, error) {
+	opts := &broadcastOptions{
+		concurrency: int(client.clientConfig().BroadcastConcurrency),
+		timeout:     time.Duration(client.clientConfig().RequestTimeout),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	if client.isClosed.Load() {
+		return nil, ErrClientClosed
+	}
+	hosts := client.getActiveHosts()
+	if len(hosts) == 0 {
+		return nil, ErrNotFoundConnection
+	}
+	if opts.concurrency <= 0 || opts.concurrency > len(hosts) {
+		opts.concurrency = len(hosts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	callOpts := &callOptions{contentType: contentType, timeout: opts.timeout}
+
+	resCh := make(chan *BroadcastResult, len(hosts))
+	go func() {
+		limit := make(chan struct{}, opts.concurrency)
+		for _, host := range hosts {
+			select {
+			case <-ctx.Done():
+				resCh <- &BroadcastResult{Host: host, Err: ctx.Err()}
+				continue
+			case limit <- struct{}{}:
+			}
+			go func(host string) {
+				defer func() {
+					<-limit
+				}()
+				start := time.Now()
+				out, err := client.call(ctx, host, method, input, callOpts)
+				resCh <- &BroadcastResult{Host: host, Out: out, Err: err, Latency: time.Since(start)}
+			}(host)
+		}
+	}()
+
+	var (
+		results = make([]*BroadcastResult, 0, len(hosts))
+		succeed int
+		failed  int
+	)
+	for range hosts {
+		res := <-resCh
+		results = append(results, res)
+		if res.Err == nil {
+			succeed++
+		} else {
+			failed++
+		}
+		if opts.quorum == 0 {
+			continue
+		}
+		if succeed >= opts.quorum {
+			return results, nil
+		}
+		if len(hosts)-failed < opts.quorum {
+			return results, ErrBroadcastQuorum
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package microgo_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo"
+	"github.com/YCloud160/microgo/example/rpcserver/handle"
+	"github.com/YCloud160/microgo/example/rpcserver/model"
+	"github.com/YCloud160/microgo/utils/encoder"
+)
+
+// listen accepts the connections and reads the requests, the connections are
+// closed after the first request when drop is set and else never answered.
+func listen(t *testing.T, drop bool) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					if _, err := conn.Read(buf); err != nil || drop {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestBroadcastQuorum(t *testing.T) {
+	port := freePort(t)
+	app, err := microgo.NewApplication(microgo.WithConfigReader(strings.NewReader(`
+service: demo
+app-listen: 127.0.0.1:0
+local-ip: 127.0.0.1
+server:
+  - name: demo.rpcServer
+    port: "` + port + `"
+client:
+  request-timeout: 5000
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.RegisterServer(microgo.NewTCPServer("demo.rpcServer", &handle.HelloServer{}, model.GreetObjCall))
+	go app.Run()
+
+	var (
+		good    = "127.0.0.1:" + port
+		failing = listen(t, true)
+		slow    = listen(t, false)
+		req     = &model.SayHelloReq{Name: "microgo"}
+		resp    = &model.SayHelloResp{}
+	)
+	client := app.NewClient("demo.rpcServer", microgo.WithClientOptionHosts(good, failing, slow))
+	defer client.Close()
+
+	input, err := microgo.GetEncoder(encoder.ProtoEncoder).Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last error
+	for i := 0; i < 50; i++ {
+		if last = client.Invoke(context.Background(), "SayHello", req, resp, microgo.WithCallHost(good)); last == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if last != nil {
+		t.Fatal(last)
+	}
+
+	// the failing host makes a quorum of 3 unreachable
+	start := time.Now()
+	results, err := client.BroadcastCall(context.Background(), encoder.ProtoEncoder, "SayHello", input, microgo.WithBroadcastQuorum(3))
+	if err != microgo.ErrBroadcastQuorum {
+		t.Fatalf("expect ErrBroadcastQuorum, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect an early return once the quorum is unreachable, took %v", elapsed)
+	}
+	byHost := make(map[string]*microgo.BroadcastResult)
+	for _, res := range results {
+		byHost[res.Host] = res
+	}
+	if res := byHost[failing]; res == nil || res.Err != microgo.ErrConnectionLost {
+		t.Fatalf("expect the failing host lost, got %+v", res)
+	}
+	if res := byHost[good]; res != nil && res.Err != nil {
+		t.Fatalf("unexpected error of the good host %v", res.Err)
+	}
+	if _, ok := byHost[slow]; ok {
+		t.Fatal("expect no result for the slow host")
+	}
+
+	// the good host reaches the quorum, the slow one is not waited for
+	start = time.Now()
+	results, err = client.BroadcastCall(context.Background(), encoder.ProtoEncoder, "SayHello", input, microgo.WithBroadcastQuorum(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect an early return on quorum, took %v", elapsed)
+	}
+	byHost = make(map[string]*microgo.BroadcastResult)
+	for _, res := range results {
+		byHost[res.Host] = res
+	}
+	if res := byHost[good]; res == nil || res.Err != nil || len(res.Out) == 0 {
+		t.Fatalf("expect the reply of the good host, got %+v", res)
+	}
+	if _, ok := byHost[slow]; ok {
+		t.Fatal("expect no result for the slow host")
+	}
+}
@@ -0,0 +1,168 @@
+package microgo
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/encoder"
+)
+
+// watchDiscovery pushes the instances given to push, QueryRoute returns the
+// last ones pushed.
+type watchDiscovery struct {
+	mu        sync.Mutex
+	instances []*naming.Instance
+	ch        chan []*naming.Instance
+}
+
+func (d *watchDiscovery) QueryRoute(name string) ([]*naming.Instance, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.instances, nil
+}
+
+func (d *watchDiscovery) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	return d.ch, nil
+}
+
+func (d *watchDiscovery) push(instances []*naming.Instance) {
+	d.mu.Lock()
+	d.instances = instances
+	d.mu.Unlock()
+	d.ch <- instances
+}
+
+func newTestApplication(t *testing.T, conf string) *Application {
+	t.Helper()
+	app, err := NewApplication(WithConfigReader(strings.NewReader("service: demo\nbase-dir: " + t.TempDir() + "\n" + conf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestEmptyWatchUpdateConfirmed(t *testing.T) {
+	d := &watchDiscovery{
+		instances: []*naming.Instance{{Name: "demo.rpcServer", Addr: "127.0.0.1:1", Weight: naming.DefaultWeight}},
+		ch:        make(chan []*naming.Instance),
+	}
+	RegisterDiscoveryBuilder("test-watch", func(conf *config.Registry) (Discovery, error) {
+		return d, nil
+	})
+	app := newTestApplication(t, `
+discovery:
+  name: test-watch
+client:
+  refresh-endpoint-interval: 1000
+  empty-route-threshold: 2
+`)
+	client := app.NewClient("demo.rpcServer")
+	defer client.Close()
+	if hosts := client.getActiveHosts(); len(hosts) != 1 {
+		t.Fatalf("expect the host of the discovery, got %v", hosts)
+	}
+
+	// a single push, the watcher does not push the same empty table again
+	d.push(nil)
+	if hosts := client.getActiveHosts(); len(hosts) != 1 {
+		t.Fatalf("expect the first empty route ignored, got %v", hosts)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(client.getActiveHosts()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("hosts not cleared after the empty route was confirmed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// listenDropping accepts the connections and closes them once a request is
+// received, as a server killed mid-call.
+func listenDropping(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Read(make([]byte, 1024))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestCallConnectionLost(t *testing.T) {
+	addr := listenDropping(t)
+	app := newTestApplication(t, `
+client:
+  request-timeout: 5000
+`)
+	client := app.NewClient("demo.rpcServer", WithClientOptionHosts(addr))
+	defer client.Close()
+
+	start := time.Now()
+	_, err := client.Call(context.Background(), addr, encoder.JsonEncoder, "SayHello", []byte("{}"))
+	if err != ErrConnectionLost {
+		t.Fatalf("expect ErrConnectionLost, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect the call to fail before the timeout, took %v", elapsed)
+	}
+}
+
+func TestCallAfterClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+
+	app := newTestApplication(t, "")
+	client := app.NewClient("demo.rpcServer", WithClientOptionHosts(l.Addr().String()))
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = client.Call(context.Background(), "", encoder.JsonEncoder, "SayHello", []byte("{}"))
+	if err != ErrClientClosed {
+		t.Fatalf("expect ErrClientClosed, got %v", err)
+	}
+	if _, err := client.getConn(l.Addr().String()); err != ErrClientClosed {
+		t.Fatalf("expect no connection after close, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expect the call to fail at once, took %v", elapsed)
+	}
+	select {
+	case <-accepted:
+		t.Fatal("expect no dial after close")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,105 @@
+package microgo
+
+import (
+	"context"
+	"github.com/YCloud160/microgo/errors"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+	"time"
+)
+
+// hostEjectDuration is how long a host stays unhealthy after a connection failure.
+const hostEjectDuration = 5 * time.Second
+
+func (client *Client) setInstances(instances []*naming.Instance) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.instances = make(map[string]*naming.Instance, len(instances))
+	for _, ins := range instances {
+		client.instances[ins.Addr] = ins
+	}
+}
+
+// reportHost records the outcome of a call, the hosts failing at connection
+// level are skipped for hostEjectDuration when others are available, and
+// for the open-timeout of the circuit breaker once it trips.
+func (client *Client) reportHost(host string, err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if err == nil {
+		delete(client.unhealthy, host)
+		delete(client.failures, host)
+		return
+	}
+	if err == ErrClientClosed || err == ErrConnectionBusy {
+		return
+	}
+	if IsRetryable(err) {
+		client.unhealthy[host] = time.Now().Add(hostEjectDuration)
+	}
+
+	breaker := client.clientConfig().CircuitBreaker
+	if breaker == nil || breaker.FailureThreshold <= 0 || !isHostFailure(err) {
+		return
+	}
+	if client.failures[host]++; client.failures[host] >= breaker.FailureThreshold {
+		xlog.Warn(context.TODO(), "circuit breaker open", zap.String("name", client.name), zap.String("host", host), zap.Int64("failures", client.failures[host]))
+		client.unhealthy[host] = time.Now().Add(time.Duration(breaker.OpenTimeout))
+		delete(client.failures, host)
+	}
+}
+
+// isHostFailure reports whether the call failed because of the host, at
+// connection level or by timeout, rather than by an error of the handler.
+func isHostFailure(err error) bool {
+	if IsRetryable(err) {
+		return true
+	}
+	e, ok := err.(*errors.Error)
+	return ok && e.Code == 9999
+}
+
+// routableHosts filters hosts, a subset of client.hosts, down to the healthy
+// hosts of the local zone while the local zone keeps enough healthy capacity,
+// and to the healthy hosts of every zone otherwise. client.mu must be held.
+func (client *Client) routableHosts(hosts []string) []string {
+	now := time.Now()
+	healthy := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if until, ok := client.unhealthy[host]; ok && now.Before(until) {
+			continue
+		}
+		healthy = append(healthy, host)
+	}
+	if len(healthy) == 0 {
+		return hosts
+	}
+	if len(client.localZone) == 0 {
+		return healthy
+	}
+
+	var localTotal int
+	for _, host := range client.hosts {
+		if client.zoneOf(host) == client.localZone {
+			localTotal++
+		}
+	}
+	local := make([]string, 0, len(healthy))
+	for _, host := range healthy {
+		if client.zoneOf(host) == client.localZone {
+			local = append(local, host)
+		}
+	}
+	if len(local) > 0 && int64(len(local))*100 >= client.clientConfig().ZoneSpillThreshold*int64(localTotal) {
+		return local
+	}
+	return healthy
+}
+
+func (client *Client) zoneOf(host string) string {
+	if ins, ok := client.instances[host]; ok {
+		return ins.Zone
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package microgo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/naming"
+)
+
+func TestRoutableHosts(t *testing.T) {
+	zoned := []*naming.Instance{
+		{Addr: "a1", Zone: "a"},
+		{Addr: "a2", Zone: "a"},
+		{Addr: "a3", Zone: "a"},
+		{Addr: "b1", Zone: "b"},
+	}
+	unlabeled := []*naming.Instance{{Addr: "a1"}, {Addr: "a2"}, {Addr: "b1"}}
+
+	tests := []struct {
+		name      string
+		localZone string
+		instances []*naming.Instance
+		unhealthy []string
+		want      []string
+	}{
+		{name: "local zone only", localZone: "a", instances: zoned, want: []string{"a1", "a2", "a3"}},
+		{name: "above threshold", localZone: "a", instances: zoned, unhealthy: []string{"a1"}, want: []string{"a2", "a3"}},
+		{name: "below threshold spill", localZone: "a", instances: zoned, unhealthy: []string{"a1", "a2"}, want: []string{"a3", "b1"}},
+		{name: "local zone down", localZone: "b", instances: zoned, unhealthy: []string{"b1"}, want: []string{"a1", "a2", "a3"}},
+		{name: "no zone labels", localZone: "a", instances: unlabeled, want: []string{"a1", "a2", "b1"}},
+		{name: "no local zone", instances: zoned, unhealthy: []string{"a2"}, want: []string{"a1", "a3", "b1"}},
+		{name: "all unhealthy", localZone: "a", instances: zoned, unhealthy: []string{"a1", "a2", "a3", "b1"}, want: []string{"a1", "a2", "a3", "b1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{
+				hosts:     naming.Addrs(tt.instances),
+				localZone: tt.localZone,
+				unhealthy: make(map[string]time.Time),
+			}
+			client.conf.Store(&config.ClientConfig{ZoneSpillThreshold: 50})
+			client.setInstances(tt.instances)
+			for _, host := range tt.unhealthy {
+				client.unhealthy[host] = time.Now().Add(time.Minute)
+			}
+			if got := client.routableHosts(client.hosts); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expect %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// micro-route is the reference registry server of microgo. It serves the
+// /micro/route/* endpoints used by the micro-route registry and discovery:
+//
+//	micro-route -listen :6971 -ttl 30s -data /var/lib/micro-route/routes.json
+//
+// An instance expires when no keepalive is received within the ttl. With
+// -data the instances survive a restart of the server.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+var logger = log.New(os.Stderr, "[micro-route] ", log.LstdFlags)
+
+func main() {
+	var (
+		listen     = flag.String("listen", ":6971", "listen address")
+		ttl        = flag.Duration("ttl", 30*time.Second, "instance ttl, renewed by every keepalive")
+		dataFile   = flag.String("data", "", "file persisting the instances, disabled when empty")
+		adminToken = flag.String("admin-token", "", "bearer token required by the admin endpoints")
+	)
+	flag.Parse()
+
+	s := newStore(*ttl, *dataFile)
+	if err := s.load(); err != nil {
+		logger.Fatalf("load %s failed: %v", *dataFile, err)
+	}
+	go expireLoop(s)
+
+	logger.Printf("listen %s", *listen)
+	if err := http.ListenAndServe(*listen, newServer(s, *adminToken).handler()); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func expireLoop(s *store) {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for now := range tick.C {
+		for _, ins := range s.expire(now) {
+			logger.Printf("expire %s %s", ins.Name, ins.Addr)
+		}
+	}
+}
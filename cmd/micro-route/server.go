@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+const (
+	codeOK           = 200
+	codeBadRequest   = 400
+	codeUnauthorized = 401
+	codeNotFound     = 404
+
+	maxWatchTimeout = 60 * time.Second
+)
+
+type response struct {
+	Code     int32                `json:"code"`
+	Msg      string               `json:"msg"`
+	Revision int64                `json:"revision,omitempty"`
+	Routes   []*naming.Instance   `json:"routes,omitempty"`
+	Services map[string][]*record `json:"services,omitempty"`
+}
+
+type watchReq struct {
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	Timeout  int64  `json:"timeout"`
+}
+
+type server struct {
+	store      *store
+	adminToken string
+}
+
+func newServer(store *store, adminToken string) *server {
+	return &server{store: store, adminToken: adminToken}
+}
+
+func (srv *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/micro/route/register", srv.register)
+	mux.HandleFunc("/micro/route/unregister", srv.unregister)
+	mux.HandleFunc("/micro/route/keepalive", srv.keepAlive)
+	mux.HandleFunc("/micro/route/query", srv.query)
+	mux.HandleFunc("/micro/route/watch", srv.watch)
+	mux.HandleFunc("/micro/route/list", srv.list)
+	mux.HandleFunc("/micro/route/admin/remove", srv.admin(srv.unregister))
+	mux.HandleFunc("/micro/route/admin/clear", srv.admin(srv.clear))
+	mux.HandleFunc("/micro/route/health", func(writer http.ResponseWriter, request *http.Request) {
+		writeResp(writer, &response{Code: codeOK, Msg: "ok"})
+	})
+	return mux
+}
+
+func (srv *server) register(writer http.ResponseWriter, request *http.Request) {
+	ins := &naming.Instance{}
+	if !readReq(writer, request, ins) {
+		return
+	}
+	if len(ins.Name) == 0 || len(ins.Addr) == 0 {
+		writeResp(writer, &response{Code: codeBadRequest, Msg: "name and addr are required"})
+		return
+	}
+	srv.store.register(ins)
+	logger.Printf("register %s %s", ins.Name, ins.Addr)
+	writeResp(writer, &response{Code: codeOK, Msg: "success"})
+}
+
+func (srv *server) unregister(writer http.ResponseWriter, request *http.Request) {
+	ins := &naming.Instance{}
+	if !readReq(writer, request, ins) {
+		return
+	}
+	if !srv.store.unregister(ins.Name, ins.Addr) {
+		writeResp(writer, &response{Code: codeNotFound, Msg: "not found instance"})
+		return
+	}
+	logger.Printf("unregister %s %s", ins.Name, ins.Addr)
+	writeResp(writer, &response{Code: codeOK, Msg: "success"})
+}
+
+func (srv *server) keepAlive(writer http.ResponseWriter, request *http.Request) {
+	ins := &naming.Instance{}
+	if !readReq(writer, request, ins) {
+		return
+	}
+	if !srv.store.keepAlive(ins.Name, ins.Addr) {
+		writeResp(writer, &response{Code: codeNotFound, Msg: "not found instance"})
+		return
+	}
+	writeResp(writer, &response{Code: codeOK, Msg: "success"})
+}
+
+func (srv *server) query(writer http.ResponseWriter, request *http.Request) {
+	req := &watchReq{}
+	if !readReq(writer, request, req) {
+		return
+	}
+	routes, revision := srv.store.query(req.Name)
+	writeResp(writer, &response{Code: codeOK, Msg: "success", Revision: revision, Routes: routes})
+}
+
+// watch answers as soon as the revision of the service differs from the one
+// of the request, or with the unchanged routes once the timeout has passed.
+func (srv *server) watch(writer http.ResponseWriter, request *http.Request) {
+	req := &watchReq{}
+	if !readReq(writer, request, req) {
+		return
+	}
+	timeout := time.Duration(req.Timeout) * time.Millisecond
+	if timeout > maxWatchTimeout {
+		timeout = maxWatchTimeout
+	}
+
+	routes, revision, changed := srv.store.watch(req.Name)
+	if revision == req.Revision && timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+	wait:
+		// an unknown service wakes up on the creation of any other
+		for revision == req.Revision {
+			select {
+			case <-changed:
+				routes, revision, changed = srv.store.watch(req.Name)
+			case <-timer.C:
+				break wait
+			case <-request.Context().Done():
+				return
+			}
+		}
+	}
+	writeResp(writer, &response{Code: codeOK, Msg: "success", Revision: revision, Routes: routes})
+}
+
+func (srv *server) list(writer http.ResponseWriter, request *http.Request) {
+	writeResp(writer, &response{Code: codeOK, Msg: "success", Services: srv.store.list()})
+}
+
+func (srv *server) clear(writer http.ResponseWriter, request *http.Request) {
+	req := &watchReq{}
+	if !readReq(writer, request, req) {
+		return
+	}
+	srv.store.clear(req.Name)
+	logger.Printf("clear %s", req.Name)
+	writeResp(writer, &response{Code: codeOK, Msg: "success"})
+}
+
+// admin requires the admin token in the authorization header when one is configured.
+func (srv *server) admin(handle http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if len(srv.adminToken) > 0 && request.Header.Get("Authorization") != "Bearer "+srv.adminToken {
+			writeResp(writer, &response{Code: codeUnauthorized, Msg: "unauthorized"})
+			return
+		}
+		handle(writer, request)
+	}
+}
+
+func readReq(writer http.ResponseWriter, request *http.Request, v any) bool {
+	body, err := io.ReadAll(request.Body)
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeResp(writer, &response{Code: codeBadRequest, Msg: err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeResp(writer http.ResponseWriter, resp *response) {
+	writer.Header().Set("content-type", "application/json;charset=utf-8")
+	bs, _ := json.Marshal(resp)
+	writer.Write(bs)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+func post(t *testing.T, url string, data any) *response {
+	t.Helper()
+	bs, _ := json.Marshal(data)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(bs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	res := &response{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRegisterAndQuery(t *testing.T) {
+	s := newStore(time.Minute, "")
+	ts := httptest.NewServer(newServer(s, "").handler())
+	defer ts.Close()
+
+	ins := map[string]any{"name": "demo", "addr": "127.0.0.1:8080", "zone": "z1"}
+	if res := post(t, ts.URL+"/micro/route/register", ins); res.Code != codeOK {
+		t.Fatalf("register failed: %v", res.Msg)
+	}
+	res := post(t, ts.URL+"/micro/route/query", map[string]string{"name": "demo"})
+	if len(res.Routes) != 1 || res.Routes[0].Zone != "z1" {
+		t.Fatalf("unexpected routes %v", res.Routes)
+	}
+	if res := post(t, ts.URL+"/micro/route/keepalive", map[string]string{"name": "demo", "addr": "unknown"}); res.Code != codeNotFound {
+		t.Fatalf("keepalive of unknown instance: %d", res.Code)
+	}
+	post(t, ts.URL+"/micro/route/query", map[string]string{"name": "typo"})
+	if _, ok := s.services["typo"]; ok {
+		t.Fatal("query added an unknown service to the store")
+	}
+	if expired := s.expire(time.Now().Add(2 * time.Minute)); len(expired) != 1 {
+		t.Fatalf("expect 1 expired instance, got %d", len(expired))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := newStore(time.Minute, "")
+	ts := httptest.NewServer(newServer(s, "").handler())
+	defer ts.Close()
+
+	first := post(t, ts.URL+"/micro/route/watch", &watchReq{Name: "demo"})
+	done := make(chan *response)
+	go func() {
+		done <- post(t, ts.URL+"/micro/route/watch", &watchReq{Name: "demo", Revision: first.Revision, Timeout: 5000})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	s.mu.Lock()
+	_, added := s.services["demo"]
+	s.mu.Unlock()
+	if added {
+		t.Fatal("watch added an unknown service to the store")
+	}
+	post(t, ts.URL+"/micro/route/register", map[string]string{"name": "other", "addr": "127.0.0.1:8081"})
+	select {
+	case res := <-done:
+		t.Fatalf("watch woken up by another service %+v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+	post(t, ts.URL+"/micro/route/register", map[string]string{"name": "demo", "addr": "127.0.0.1:8080"})
+	select {
+	case res := <-done:
+		if res.Revision == first.Revision || len(res.Routes) != 1 {
+			t.Fatalf("unexpected watch response %+v", res)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch not woken up by the registration")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "routes.json")
+	s := newStore(time.Minute, dataFile)
+	s.register(&naming.Instance{Name: "demo", Addr: "127.0.0.1:8080"})
+
+	restored := newStore(time.Minute, dataFile)
+	if err := restored.load(); err != nil {
+		t.Fatal(err)
+	}
+	if routes, _ := restored.query("demo"); len(routes) != 1 {
+		t.Fatalf("expect 1 restored instance, got %d", len(routes))
+	}
+}
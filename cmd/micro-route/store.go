@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+type record struct {
+	naming.Instance
+	RegisterAt int64 `json:"registerAt"`
+	ExpireAt   int64 `json:"expireAt"`
+}
+
+type service struct {
+	revision int64
+	records  map[string]*record
+	// changed is closed and replaced whenever the routes of the service change.
+	changed chan struct{}
+}
+
+// store keeps the instances of every service, an instance expires when it
+// is not kept alive within ttl.
+type store struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	dataFile string
+	revision int64
+	services map[string]*service
+	// created is closed and replaced whenever a service is added, the
+	// watchers of the unknown services wait on it.
+	created chan struct{}
+}
+
+func newStore(ttl time.Duration, dataFile string) *store {
+	return &store{
+		ttl:      ttl,
+		dataFile: dataFile,
+		services: make(map[string]*service),
+		created:  make(chan struct{}),
+	}
+}
+
+// service returns the service, added when unknown. s.mu must be held.
+func (s *store) service(name string) *service {
+	srv, ok := s.services[name]
+	if !ok {
+		srv = &service{
+			records: make(map[string]*record),
+			changed: make(chan struct{}),
+		}
+		s.services[name] = srv
+		close(s.created)
+		s.created = make(chan struct{})
+	}
+	return srv
+}
+
+// touch bumps the revision of the service and wakes up its watchers, s.mu must be held.
+func (s *store) touch(srv *service) {
+	s.revision++
+	srv.revision = s.revision
+	close(srv.changed)
+	srv.changed = make(chan struct{})
+}
+
+func (s *store) register(ins *naming.Instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	srv := s.service(ins.Name)
+	old, ok := srv.records[ins.Addr]
+	r := &record{Instance: *ins, RegisterAt: now.UnixMilli(), ExpireAt: now.Add(s.ttl).UnixMilli()}
+	if ok {
+		r.RegisterAt = old.RegisterAt
+	}
+	srv.records[ins.Addr] = r
+	if !ok || !sameInstance(&old.Instance, ins) {
+		s.touch(srv)
+		s.save()
+	}
+}
+
+func (s *store) unregister(name, addr string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := s.services[name]
+	if !ok {
+		return false
+	}
+	if _, ok := srv.records[addr]; !ok {
+		return false
+	}
+	delete(srv.records, addr)
+	s.touch(srv)
+	s.save()
+	return true
+}
+
+// keepAlive extends the ttl of the instance, false if it is unknown.
+func (s *store) keepAlive(name, addr string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := s.services[name]
+	if !ok {
+		return false
+	}
+	r, ok := srv.records[addr]
+	if !ok {
+		return false
+	}
+	r.ExpireAt = time.Now().Add(s.ttl).UnixMilli()
+	return true
+}
+
+func (s *store) clear(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := s.services[name]
+	if !ok || len(srv.records) == 0 {
+		return
+	}
+	srv.records = make(map[string]*record)
+	s.touch(srv)
+	s.save()
+}
+
+// query returns the instances of the service and its revision, an unknown
+// service is not added to the store.
+func (s *store) query(name string) ([]*naming.Instance, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := s.services[name]
+	if !ok {
+		return []*naming.Instance{}, 0
+	}
+	return srv.instances(), srv.revision
+}
+
+// watch returns the instances of the service, its revision, and a channel
+// closed on the next change. An unknown service is not added to the store,
+// the channel is then closed when any service is added.
+func (s *store) watch(name string) ([]*naming.Instance, int64, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv, ok := s.services[name]
+	if !ok {
+		return []*naming.Instance{}, 0, s.created
+	}
+	return srv.instances(), srv.revision, srv.changed
+}
+
+// instances returns the instances of the service sorted by address, s.mu must be held.
+func (srv *service) instances() []*naming.Instance {
+	instances := make([]*naming.Instance, 0, len(srv.records))
+	for _, r := range srv.records {
+		ins := r.Instance
+		instances = append(instances, &ins)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Addr < instances[j].Addr
+	})
+	return instances
+}
+
+func (s *store) list() map[string][]*record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	services := make(map[string][]*record, len(s.services))
+	for name, srv := range s.services {
+		if len(srv.records) == 0 {
+			continue
+		}
+		records := make([]*record, 0, len(srv.records))
+		for _, r := range srv.records {
+			cp := *r
+			records = append(records, &cp)
+		}
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].Addr < records[j].Addr
+		})
+		services[name] = records
+	}
+	return services
+}
+
+// expire removes the instances whose ttl has passed.
+func (s *store) expire(now time.Time) []*naming.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []*naming.Instance
+	for _, srv := range s.services {
+		changed := false
+		for addr, r := range srv.records {
+			if r.ExpireAt <= now.UnixMilli() {
+				delete(srv.records, addr)
+				ins := r.Instance
+				expired = append(expired, &ins)
+				changed = true
+			}
+		}
+		if changed {
+			s.touch(srv)
+		}
+	}
+	if len(expired) > 0 {
+		s.save()
+	}
+	return expired
+}
+
+type snapshot struct {
+	Revision int64                `json:"revision"`
+	Services map[string][]*record `json:"services"`
+}
+
+// save writes the instances to the data file, s.mu must be held.
+func (s *store) save() {
+	if len(s.dataFile) == 0 {
+		return
+	}
+	snap := &snapshot{Revision: s.revision, Services: make(map[string][]*record, len(s.services))}
+	for name, srv := range s.services {
+		for _, r := range srv.records {
+			snap.Services[name] = append(snap.Services[name], r)
+		}
+	}
+	bs, err := json.Marshal(snap)
+	if err != nil {
+		logger.Printf("marshal snapshot failed: %v", err)
+		return
+	}
+	tmp := s.dataFile + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0644); err != nil {
+		logger.Printf("write snapshot failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.dataFile); err != nil {
+		logger.Printf("rename snapshot failed: %v", err)
+	}
+}
+
+// load restores the instances saved in the data file, every instance gets a
+// full ttl to send its next keepalive.
+func (s *store) load() error {
+	if len(s.dataFile) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.dataFile), 0755); err != nil {
+		return err
+	}
+	bs, err := os.ReadFile(s.dataFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	snap := &snapshot{}
+	if err := json.Unmarshal(bs, snap); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expireAt := time.Now().Add(s.ttl).UnixMilli()
+	s.revision = snap.Revision
+	for name, records := range snap.Services {
+		srv := s.service(name)
+		for _, r := range records {
+			r.ExpireAt = expireAt
+			srv.records[r.Addr] = r
+		}
+		srv.revision = s.revision
+	}
+	return nil
+}
+
+func sameInstance(a, b *naming.Instance) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return string(ab) == string(bb)
+}
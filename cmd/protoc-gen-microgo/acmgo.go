@@ -9,7 +9,7 @@ import (
 // Paths for packages used by code generated in this file,
 // relative to the import_prefix of the generator.Generator.
 const (
-	acmgoPackage = protogen.GoImportPath("github.com/luban-cloud/utils/acm")
+	acmgoPackage = protogen.GoImportPath("github.com/YCloud160/microgo/acm")
 	jsonPackage  = protogen.GoImportPath("encoding/json")
 )
 
@@ -185,4 +185,9 @@ func (t *acmgo) generateAcmData(name, dataIdKey, dataName string) {
 		return &%s{}, nil
 		}`, name, name, name, name, name))
 	t.P()
+
+	t.P(fmt.Sprintf("func Subscribe%sFromACM(fn func(data *%s)) (cancel func(), err error) {", name, name))
+	t.P("return acm.Subscribe(fn)")
+	t.P("}")
+	t.P()
 }
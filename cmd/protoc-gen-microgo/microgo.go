@@ -161,47 +161,63 @@ func (mg *microgo) generateClientCode(service *protogen.Service) {
 	}`, serviceName, serviceName, serviceName))
 	mg.P()
 
+	mg.P(fmt.Sprintf(`// Close releases the connections of the client.
+	func (client *%sClient) Close() error {
+		return client.client.Close()
+	}`, serviceName))
+	mg.P()
+
 	for _, method := range service.Methods {
 		mg.generateClientMethod(serviceName, method)
 		mg.P()
+		mg.generateClientAsyncMethod(serviceName, method)
+		mg.P()
+		mg.generateClientBroadcastMethod(serviceName, method)
+		mg.P()
 	}
 }
 
 func (mg *microgo) generateClientMethod(serviceName string, method *protogen.Method) {
-	mg.P(fmt.Sprintf(`func (client *%sClient) %s(ctx context.Context, req *%s) (*%s, error) {
-			input, err := proto.Marshal(req)
-			if err != nil {
+	mg.P(fmt.Sprintf(`func (client *%sClient) %s(ctx context.Context, req *%s, opts ...microgo.CallOption) (*%s, error) {
+			resp := %s{}
+			if err := client.client.Invoke(ctx, "%s", req, &resp, opts...); err != nil {
 				return nil, err
 			}
-			out, err := client.client.Call(ctx, "", "proto", "%s", input)
+			return &resp, nil
+		}`, serviceName, method.GoName, method.Input.GoIdent.GoName, method.Output.GoIdent.GoName, method.Output.GoIdent.GoName, method.GoName))
+}
+
+func (mg *microgo) generateClientAsyncMethod(serviceName string, method *protogen.Method) {
+	mg.P(fmt.Sprintf(`func (client *%sClient) %sAsync(ctx context.Context, req *%s, callback func(*%s, error), opts ...microgo.CallOption) *microgo.TypedFuture[*%s] {
+			return microgo.Async(ctx, func(ctx context.Context) (*%s, error) {
+				return client.%s(ctx, req, opts...)
+			}, callback)
+		}`, serviceName, method.GoName, method.Input.GoIdent.GoName, method.Output.GoIdent.GoName, method.Output.GoIdent.GoName,
+		method.Output.GoIdent.GoName, method.GoName))
+}
+
+func (mg *microgo) generateClientBroadcastMethod(serviceName string, method *protogen.Method) {
+	mg.P(fmt.Sprintf(`func (client *%sClient) Broadcast%s(ctx context.Context, req *%s, opts ...microgo.BroadcastOption) ([]*microgo.BroadcastReply[*%s], error) {
+			input, err := proto.Marshal(req)
 			if err != nil {
 				return nil, err
 			}
-			resp := %s{}
-			if err := proto.Unmarshal(out, &resp); err != nil {
-				return nil, err
+			results, err := client.client.BroadcastCall(ctx, "proto", "%s", input, opts...)
+			replies := make([]*microgo.BroadcastReply[*%s], 0, len(results))
+			for _, res := range results {
+				reply := &microgo.BroadcastReply[*%s]{Host: res.Host, Err: res.Err, Latency: res.Latency}
+				if res.Err == nil {
+					resp := %s{}
+					if reply.Err = proto.Unmarshal(res.Out, &resp); reply.Err == nil {
+						reply.Resp = &resp
+					}
+				}
+				replies = append(replies, reply)
 			}
-			return &resp, nil
-		}`, serviceName, method.GoName, method.Input.GoIdent.GoName, method.Output.GoIdent.GoName, method.GoName, method.Output.GoIdent.GoName))
-}
-
-//func (mg *microgo) generateClientBroadcastMethod(serviceName string, method *protogen.Method) {
-//	mg.P(fmt.Sprintf(`func (client *%sClient) Broadcast%s(ctx context.Context, req *%s) (*%s, map[string]error) {
-//			input, err := proto.Marshal(req)
-//			if err != nil {
-//				return nil, err
-//			}
-//			out, errs := client.client.BroadcastCall(ctx, "", "proto", "%s", input)
-//			if errs != nil {
-//				return nil, errs
-//			}
-//			resp := %s{}
-//			if err := proto.Unmarshal(out, &resp); err != nil {
-//				return nil, err
-//			}
-//			return &resp, nil
-//		}`, serviceName, method.GoName, method.Input.GoIdent.GoName, method.Output.GoIdent.GoName, method.GoName, method.Output.GoIdent.GoName))
-//}
+			return replies, err
+		}`, serviceName, method.GoName, method.Input.GoIdent.GoName, method.Output.GoIdent.GoName, method.GoName,
+		method.Output.GoIdent.GoName, method.Output.GoIdent.GoName, method.Output.GoIdent.GoName))
+}
 
 func (mg *microgo) generateMethod(service *protogen.Service) {
 	serviceName := upperFirstLatter(service.GoName)
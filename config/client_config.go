@@ -1,22 +1,113 @@
 package config
 
-import "time"
+import (
+	"runtime"
+	"time"
+)
 
 const (
 	defaultRequestTimeout          = 5000
 	defaultRefreshEndpointInterval = 10000
+	defaultBroadcastConcurrency    = 16
+	defaultDialTimeout             = 1000
+	defaultZoneSpillThreshold      = 50
+	defaultEmptyRouteThreshold     = 3
+	defaultBreakerOpenTimeout      = 5000
+)
+
+// The balancers picking the host of the calls without routing key.
+const (
+	BalancerRoundRobin = "round-robin"
+	BalancerRandom     = "random"
 )
 
 type ClientConfig struct {
 	RequestTimeout          int64 `yaml:"request-timeout"`
 	RefreshEndpointInterval int64 `yaml:"refresh-endpoint-interval"`
+	BroadcastConcurrency    int64 `yaml:"broadcast-concurrency"`
+	PoolSize                int64 `yaml:"pool-size"`
+	DialTimeout             int64 `yaml:"dial-timeout"`
+	MaxRequestsPerConn      int64 `yaml:"max-requests-per-conn"`
+	// ZoneSpillThreshold is the percentage of healthy hosts in the local zone
+	// under which the calls spill to the other zones.
+	ZoneSpillThreshold int64 `yaml:"zone-spill-threshold"`
+	// EmptyRouteThreshold is the number of empty route tables in a row after
+	// which the hosts of a client are cleared.
+	EmptyRouteThreshold int64 `yaml:"empty-route-threshold"`
+	// Balancer is BalancerRoundRobin, the default, or BalancerRandom.
+	Balancer       string                `yaml:"balancer"`
+	Retry          *RetryConfig          `yaml:"retry"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit-breaker"`
+	// Hosts are the static hosts of the target, the discovery is not used
+	// when they are set.
+	Hosts []string `yaml:"hosts"`
+}
+
+// RetryConfig is the retry policy of the calls without WithCallRetry.
+type RetryConfig struct {
+	MaxAttempts int64 `yaml:"max-attempts"`
+	Backoff     int64 `yaml:"backoff"`
+}
+
+// CircuitBreakerConfig skips a host for open-timeout once failure-threshold
+// calls in a row failed on it.
+type CircuitBreakerConfig struct {
+	FailureThreshold int64 `yaml:"failure-threshold"`
+	OpenTimeout      int64 `yaml:"open-timeout"`
 }
 
-func loadClientConfig(conf *ClientConfig) *ClientConfig {
+// loadClientConfig sets the unset or out of range values of conf to those of
+// defaults, the completed client block for a target, or else to the package
+// defaults. The retry and circuit-breaker blocks are inherited as a whole,
+// the static hosts are not.
+func loadClientConfig(conf, defaults *ClientConfig) *ClientConfig {
 	if conf == nil {
 		conf = &ClientConfig{}
 	}
-	conf.RequestTimeout = getValue(conf.RequestTimeout, 1000, defaultRequestTimeout) * int64(time.Millisecond)
-	conf.RefreshEndpointInterval = getValue(conf.RefreshEndpointInterval, 1000, defaultRefreshEndpointInterval)
+	if defaults == nil {
+		defaults = &ClientConfig{
+			RequestTimeout:          defaultRequestTimeout * int64(time.Millisecond),
+			RefreshEndpointInterval: defaultRefreshEndpointInterval,
+			BroadcastConcurrency:    defaultBroadcastConcurrency,
+			PoolSize:                int64(runtime.NumCPU()),
+			DialTimeout:             defaultDialTimeout * int64(time.Millisecond),
+			ZoneSpillThreshold:      defaultZoneSpillThreshold,
+			EmptyRouteThreshold:     defaultEmptyRouteThreshold,
+			Balancer:                BalancerRoundRobin,
+		}
+	}
+	conf.RequestTimeout = getMillis(conf.RequestTimeout, 1, defaults.RequestTimeout)
+	conf.RefreshEndpointInterval = getValue(conf.RefreshEndpointInterval, 1000, defaults.RefreshEndpointInterval)
+	conf.BroadcastConcurrency = getValue(conf.BroadcastConcurrency, 1, defaults.BroadcastConcurrency)
+	conf.PoolSize = getValue(conf.PoolSize, 1, defaults.PoolSize)
+	conf.DialTimeout = getMillis(conf.DialTimeout, 1, defaults.DialTimeout)
+	conf.MaxRequestsPerConn = getValue(conf.MaxRequestsPerConn, 1, defaults.MaxRequestsPerConn)
+	conf.ZoneSpillThreshold = getValue(conf.ZoneSpillThreshold, 1, defaults.ZoneSpillThreshold)
+	conf.EmptyRouteThreshold = getValue(conf.EmptyRouteThreshold, 1, defaults.EmptyRouteThreshold)
+	if len(conf.Balancer) == 0 {
+		conf.Balancer = defaults.Balancer
+	}
+	switch {
+	case conf.Retry != nil:
+		conf.Retry.Backoff = getMillis(conf.Retry.Backoff, 1, 0)
+	case defaults.Retry != nil:
+		retry := *defaults.Retry
+		conf.Retry = &retry
+	}
+	switch {
+	case conf.CircuitBreaker != nil:
+		conf.CircuitBreaker.OpenTimeout = getMillis(conf.CircuitBreaker.OpenTimeout, 1, defaultBreakerOpenTimeout*int64(time.Millisecond))
+	case defaults.CircuitBreaker != nil:
+		breaker := *defaults.CircuitBreaker
+		conf.CircuitBreaker = &breaker
+	}
 	return conf
 }
+
+// getMillis converts inputVal from milliseconds, defaultVal is a duration.
+func getMillis(inputVal, compareVal, defaultVal int64) int64 {
+	if inputVal < compareVal {
+		return defaultVal
+	}
+	return inputVal * int64(time.Millisecond)
+}
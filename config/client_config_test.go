@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientsConfig(t *testing.T) {
+	t.Setenv("MICROGO_CLIENTS__DEMO_RPCSERVER__POOL_SIZE", "4")
+	t.Setenv("MICROGO_CLIENTS__UNKNOWN__POOL_SIZE", "8")
+
+	conf, err := Decode(strings.NewReader(`
+client:
+  request-timeout: 3000
+  retry:
+    max-attempts: 2
+clients:
+  demo.rpcServer:
+    balancer: random
+    request-timeout: 500
+    circuit-breaker:
+      failure-threshold: 5
+  demo.static:
+    request-timeout: 1000
+    hosts: [127.0.0.1:8080]
+`), "clients[demo.static].retry.max-attempts=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rpc := conf.GetClientConfig("demo.rpcServer")
+	if rpc.PoolSize != 4 || rpc.Balancer != BalancerRandom {
+		t.Fatalf("unexpected target config %+v", rpc)
+	}
+	// a sub-second timeout is kept, the unset blocks come from the client block
+	if rpc.RequestTimeout != int64(500*time.Millisecond) || rpc.Retry.MaxAttempts != 2 || len(rpc.Hosts) != 0 {
+		t.Fatalf("expect the client block inherited, got %+v", rpc)
+	}
+	if rpc.CircuitBreaker.OpenTimeout != defaultBreakerOpenTimeout*int64(time.Millisecond) {
+		t.Fatalf("expect default open-timeout, got %d", rpc.CircuitBreaker.OpenTimeout)
+	}
+	static := conf.GetClientConfig("demo.static")
+	if static.RequestTimeout != int64(time.Second) || static.Retry.MaxAttempts != 3 || len(static.Hosts) != 1 {
+		t.Fatalf("unexpected target config %+v", static)
+	}
+	if conf.ClientConf.Retry.MaxAttempts != 2 || len(conf.Clients) != 2 {
+		t.Fatalf("the client block changed by a target: %+v", conf.ClientConf)
+	}
+	if other := conf.GetClientConfig("other"); other != conf.ClientConf {
+		t.Fatal("expect the client block for a target without entry")
+	}
+
+	_, err = Decode(strings.NewReader(`
+client:
+  hosts: [127.0.0.1:8080]
+clients:
+  demo.rpcServer:
+    balancer: least
+    hosts: [localhost]
+`))
+	for _, w := range []string{"clients[demo.rpcServer].balancer: unknown balancer", "clients[demo.rpcServer].hosts[0]: invalid host", "client.hosts: static hosts are set by target"} {
+		if err == nil || !strings.Contains(err.Error(), w) {
+			t.Errorf("missing %q in %v", w, err)
+		}
+	}
+}
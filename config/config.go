@@ -1,57 +1,173 @@
+// Package config loads the yaml configuration of the application.
+//
+// The value of a field comes from, in order of precedence:
+//
+//  1. the path=value overrides given to Load or Decode, e.g. the -config-set
+//     flags: -config-set client.request-timeout=3000 -config-set server[demo.rpcServer].port=9090
+//     -config-set clients[demo.rpcServer].pool-size=4
+//  2. the environment variables named MICROGO_ followed by the yaml keys of
+//     the path in upper case, - and . as _, separated by __, a server being
+//     selected by name: MICROGO_CLIENT__REQUEST_TIMEOUT, MICROGO_SERVER__DEMO_RPCSERVER__PORT,
+//     the same for a target of the clients block: MICROGO_CLIENTS__DEMO_RPCSERVER__POOL_SIZE
+//  3. the file, where ${ENV} and ${ENV:default} are replaced by the
+//     environment variable ENV, or else the default
+//  4. the defaults of the package
 package config
 
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
 	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
 var (
-	initConfigOnce sync.Once
-	_config        *Config
+	configMu sync.Mutex
+	_config  *Config
 )
 
+const overrideFlag = "config-set"
+
 type Config struct {
-	Service    string          `yaml:"service"`
-	AppListen  string          `yaml:"app-listen"`
-	LocalIP    string          `yaml:"local-ip"`
-	KeepAlive  int             `yaml:"keep-alive"`
-	LogLevel   string          `yaml:"log-level"`
-	LogDir     string          `yaml:"log-dir"`
-	BaseDir    string          `yaml:"base-dir"`
-	Registry   *Registry       `json:"registry"`
-	ServerConf []*ServerConfig `yaml:"server"`
-	ClientConf *ClientConfig   `yaml:"client"`
+	Service                 string          `yaml:"service"`
+	AppListen               string          `yaml:"app-listen"`
+	LocalIP                 string          `yaml:"local-ip"`
+	LocalZone               string          `yaml:"local-zone"`
+	KeepAlive               int             `yaml:"keep-alive"`
+	ReadinessFailureTimeout int             `yaml:"readiness-failure-timeout"`
+	ReloadInterval          int             `yaml:"reload-interval"`
+	LogLevel                string          `yaml:"log-level"`
+	LogDir                  string          `yaml:"log-dir"`
+	BaseDir                 string          `yaml:"base-dir"`
+	Registry                *Registry       `yaml:"registry"`
+	Registries              []*Registry     `yaml:"registries"`
+	Discovery               *Registry       `yaml:"discovery"`
+	ServerConf              []*ServerConfig `yaml:"server"`
+	ClientConf              *ClientConfig   `yaml:"client"`
+	// Clients configures the clients by target, the name given to NewClient,
+	// the unset fields taking the value of the client block, but the hosts.
+	Clients map[string]*ClientConfig `yaml:"clients"`
+
+	path      string
+	overrides []string
+	completed bool
 }
 
-type Registry struct {
-	Name string            `json:"name"`
-	Data map[string]string `json:"data"`
+// Path returns the file the configuration was loaded from, if any.
+func (conf *Config) Path() string {
+	return conf.path
 }
 
-func init() {
-	initConfigOnce.Do(loadConfig)
+// Overrides returns the overrides the configuration was loaded with.
+func (conf *Config) Overrides() []string {
+	return conf.overrides
 }
 
-func loadConfig() {
-	var configFile string
-	flag.StringVar(&configFile, "config", "config.yaml", "--config config.yaml")
-	flag.Parse()
+// Registry configures a registry or discovery backend, Name selects the
+// backend and Data holds its settings.
+type Registry struct {
+	Name string            `yaml:"name" json:"name"`
+	Data map[string]string `yaml:"data" json:"data"`
+
+	parent *Config
+}
+
+// Parent returns the configuration holding the registry block, once completed.
+func (r *Registry) Parent() *Config {
+	return r.parent
+}
 
-	file, err := os.Open(configFile)
+// Load reads the configuration from the yaml file at path, see Decode.
+func Load(path string, overrides ...string) (*Config, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		panic(fmt.Sprintf("open config file failed, path:%s, error:%v", configFile, err))
+		return nil, fmt.Errorf("open config file failed, path:%s, error:%w", path, err)
 	}
 	defer file.Close()
+	conf, err := Decode(file, overrides...)
+	if err != nil {
+		return nil, err
+	}
+	conf.path = path
+	return conf, nil
+}
+
+// Decode reads a yaml configuration from r, applies the environment and the
+// path=value overrides as described in the package documentation, and
+// completes it. The unknown keys and the invalid settings are reported
+// together in a *ValidationError.
+func Decode(r io.Reader, overrides ...string) (*Config, error) {
+	doc := &yaml.Node{}
+	if err := yaml.NewDecoder(r).Decode(doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+	root := doc
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if err := applyOverrides(root, overrides); err != nil {
+		return nil, err
+	}
 
+	errs := &ValidationError{}
+	checkFields(errs, root, reflect.TypeOf(Config{}), "")
 	conf := &Config{}
-	decode := yaml.NewDecoder(file)
-	if err := decode.Decode(conf); err != nil {
-		panic(err)
+	if err := root.Decode(conf); err != nil {
+		te, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		for _, msg := range te.Errors {
+			errs.Add("", "%s", msg)
+		}
+	}
+	validate(conf, errs)
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	conf.overrides = overrides
+	return Complete(conf), nil
+}
+
+var (
+	configFile      = "config.yaml"
+	configOverrides Overrides
+)
+
+func init() {
+	RegisterFlags(flag.CommandLine)
+}
+
+// RegisterFlags defines the -config and -config-set flags read by
+// LoadFromFlags on fs, they are defined on the command line at init.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFile, "config", configFile, "--config config.yaml")
+	fs.Var(&configOverrides, overrideFlag, "--config-set path=value, may be repeated")
+}
+
+// LoadFromFlags loads the file named by the -config flag, config.yaml by
+// default, with the overrides of the -config-set flags. The flags are not
+// parsed here, the program parses them before creating the application.
+func LoadFromFlags() (*Config, error) {
+	return Load(configFile, configOverrides...)
+}
+
+// Complete sets the defaults of the unset values of conf, a configuration
+// built in code must be completed before use. It is a no-op on a completed one.
+func Complete(conf *Config) *Config {
+	for _, rc := range append(conf.Registries, conf.Registry, conf.Discovery) {
+		if rc != nil {
+			rc.parent = conf
+		}
 	}
+	if conf.completed {
+		return conf
+	}
+	conf.completed = true
 
 	conf = _loadConfig(conf)
 
@@ -59,9 +175,11 @@ func loadConfig() {
 		conf.ServerConf[i] = loadServerConfig(srvConf)
 	}
 
-	conf.ClientConf = loadClientConfig(conf.ClientConf)
-
-	_config = conf
+	conf.ClientConf = loadClientConfig(conf.ClientConf, nil)
+	for name, clientConf := range conf.Clients {
+		conf.Clients[name] = loadClientConfig(clientConf, conf.ClientConf)
+	}
+	return conf
 }
 
 func _loadConfig(conf *Config) *Config {
@@ -71,40 +189,82 @@ func _loadConfig(conf *Config) *Config {
 	if conf.KeepAlive == 0 {
 		conf.KeepAlive = 10000
 	}
+	if conf.ReadinessFailureTimeout == 0 {
+		conf.ReadinessFailureTimeout = 30000
+	}
+	if conf.ReloadInterval == 0 {
+		conf.ReloadInterval = 5000
+	}
 	return conf
 }
 
-func GetConfig() *Config {
-	if _config == nil {
-		panic("config not init")
+// SetConfig sets the configuration returned by GetConfig.
+func SetConfig(conf *Config) {
+	configMu.Lock()
+	_config = Complete(conf)
+	configMu.Unlock()
+}
+
+// LookupServerConfig returns the configuration of the server named name.
+func (conf *Config) LookupServerConfig(name string) (*ServerConfig, bool) {
+	for _, srvConf := range conf.ServerConf {
+		if srvConf.Name == name {
+			return srvConf, true
+		}
 	}
-	return _config
+	return nil, false
 }
 
-func GetBaseDir() string {
-	if _config == nil {
-		return ""
+// GetClientConfig returns the configuration of the clients of the target
+// name, the client block when it has none.
+func (conf *Config) GetClientConfig(name string) *ClientConfig {
+	if clientConf, ok := conf.Clients[name]; ok {
+		return clientConf
 	}
-	return _config.BaseDir
+	return conf.ClientConf
 }
 
-func GetServerConfig(name string) *ServerConfig {
-	var config = &ServerConfig{}
-	if _config == nil {
-		panic("config not init")
+// GetServerConfig returns the configuration of the server named name, the
+// defaults without port when it is not configured.
+func (conf *Config) GetServerConfig(name string) *ServerConfig {
+	if srvConf, ok := conf.LookupServerConfig(name); ok {
+		return srvConf
 	}
-	for _, conf := range _config.ServerConf {
-		if conf.Name == name {
-			config = conf
-			break
+	return loadServerConfig(&ServerConfig{Name: name})
+}
+
+// Current returns the configuration set by SetConfig, or else loads it from
+// the -config flag on first use.
+func Current() (*Config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if _config == nil {
+		conf, err := LoadFromFlags()
+		if err != nil {
+			return nil, err
 		}
+		_config = conf
 	}
-	return config
+	return _config, nil
 }
 
-func GetClientConfig() *ClientConfig {
-	if _config == nil {
-		return &ClientConfig{}
+// GetConfig is Current panicking when the configuration cannot be loaded.
+func GetConfig() *Config {
+	conf, err := Current()
+	if err != nil {
+		panic(err)
 	}
-	return _config.ClientConf
+	return conf
+}
+
+func GetBaseDir() string {
+	return GetConfig().BaseDir
+}
+
+func GetServerConfig(name string) *ServerConfig {
+	return GetConfig().GetServerConfig(name)
+}
+
+func GetClientConfig() *ClientConfig {
+	return GetConfig().ClientConf
 }
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the
+// configuration, see Decode.
+const EnvPrefix = "MICROGO_"
+
+// sequenceKeys are the keys holding lists of entries selected by name.
+var sequenceKeys = map[string]struct{}{"server": {}}
+
+// entryKeys are the keys holding mappings of entries selected by name.
+var entryKeys = map[string]struct{}{"clients": {}}
+
+// errNoEntry is returned by setPath for an environment variable selecting a
+// missing entry, the variable is ignored as its name cannot be recovered.
+var errNoEntry = errors.New("no entry")
+
+// Overrides collects the path=value overrides given on the command line, it
+// is a flag.Value.
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *Overrides) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("override %q is not path=value", v)
+	}
+	*o = append(*o, v)
+	return nil
+}
+
+// applyOverrides expands the ${ENV:default} placeholders of the document,
+// then applies the MICROGO_ environment variables and the overrides.
+func applyOverrides(root *yaml.Node, overrides []string) error {
+	expandNode(root)
+
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, EnvPrefix) {
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimPrefix(env, EnvPrefix), "=")
+		segs := strings.Split(name, "__")
+		// the variables naming no field are left to other programs
+		if !knownEnvPath(reflect.TypeOf(Config{}), segs) {
+			continue
+		}
+		if err := setPath(root, segs, value, true, true); err != nil && !errors.Is(err, errNoEntry) {
+			return fmt.Errorf("env %s%s: %w", EnvPrefix, name, err)
+		}
+	}
+
+	for _, override := range overrides {
+		path, value, ok := strings.Cut(override, "=")
+		if !ok {
+			return fmt.Errorf("override %q is not path=value", override)
+		}
+		segs, err := splitPath(path)
+		if err != nil {
+			return err
+		}
+		if err := setPath(root, segs, value, false, true); err != nil {
+			return fmt.Errorf("override %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// splitPath splits a path such as client.request-timeout or
+// server[demo.rpcServer].port into its keys, the name of a server being
+// the key following server.
+func splitPath(path string) ([]string, error) {
+	var segs []string
+	for len(path) > 0 {
+		i := strings.IndexAny(path, ".[")
+		if i < 0 {
+			segs = append(segs, path)
+			break
+		}
+		if i > 0 {
+			segs = append(segs, path[:i])
+		}
+		if path[i] == '.' {
+			path = path[i+1:]
+			continue
+		}
+		end := strings.IndexByte(path[i:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		segs = append(segs, path[i+1:i+end])
+		path = strings.TrimPrefix(path[i+end+1:], ".")
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("empty override path")
+	}
+	return segs, nil
+}
+
+// envKey is the form of a key or a server name in an environment variable,
+// upper case with every other character than letters and digits as _.
+func envKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// setPath sets the value at the path of keys under node, creating the
+// missing keys. A sequence is indexed by the name of its entries, a missing
+// entry is created for an override. The keys of the environment variables are
+// matched in their envKey form. root is set for the document, where the
+// missing sequence keys are created.
+func setPath(node *yaml.Node, segs []string, value string, env, root bool) error {
+	if len(segs) == 0 {
+		setScalar(node, value)
+		return nil
+	}
+	match := func(key string) bool {
+		if env {
+			return envKey(key) == segs[0]
+		}
+		return key == segs[0]
+	}
+
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				if item.Content[i].Value == "name" && match(item.Content[i+1].Value) {
+					return setPath(item, segs[1:], value, env, false)
+				}
+			}
+		}
+		if env {
+			return errNoEntry
+		}
+		item := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "name"},
+			{Kind: yaml.ScalarNode, Value: segs[0], Style: yaml.DoubleQuotedStyle},
+		}}
+		node.Content = append(node.Content, item)
+		return setPath(item, segs[1:], value, env, false)
+	case yaml.ScalarNode, 0:
+		if node.Kind == yaml.ScalarNode && node.Tag != "!!null" && len(node.Value) > 0 {
+			return fmt.Errorf("%s is not a mapping", segs[0])
+		}
+		*node = yaml.Node{Kind: yaml.MappingNode}
+	case yaml.MappingNode:
+	default:
+		return fmt.Errorf("%s is not a mapping", segs[0])
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if !match(node.Content[i].Value) {
+			continue
+		}
+		if _, ok := entryKeys[node.Content[i].Value]; ok && env && root && len(segs) > 1 {
+			return setEntry(node.Content[i+1], segs[1:], value)
+		}
+		return setPath(node.Content[i+1], segs[1:], value, env, false)
+	}
+	key := segs[0]
+	if env {
+		key = strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+		if _, ok := entryKeys[key]; ok && root {
+			return errNoEntry
+		}
+	}
+	child := &yaml.Node{}
+	if _, ok := sequenceKeys[key]; ok && root {
+		child.Kind = yaml.SequenceNode
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+	return setPath(child, segs[1:], value, env, false)
+}
+
+// setEntry sets the value at the path of keys of an environment variable
+// under the entry of node it selects, the entry must exist as its name
+// cannot be recovered from the variable.
+func setEntry(node *yaml.Node, segs []string, value string) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if envKey(node.Content[i].Value) == segs[0] {
+				return setPath(node.Content[i+1], segs[1:], value, true, false)
+			}
+		}
+	}
+	return errNoEntry
+}
+
+// setScalar sets the value of node, the type of which is resolved again. The
+// value of a sequence is the comma separated list of its items.
+func setScalar(node *yaml.Node, value string) {
+	if node.Kind == yaml.SequenceNode {
+		node.Content = nil
+		for _, item := range strings.Split(value, ",") {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: strings.TrimSpace(item)})
+		}
+		return
+	}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// expandNode replaces the ${ENV} and ${ENV:default} placeholders of the
+// values under node by the environment variable, or else the default.
+func expandNode(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if v := expand(node.Value); v != node.Value {
+			node.Value = v
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			expandNode(node.Content[i])
+		}
+	default:
+		for _, child := range node.Content {
+			expandNode(child)
+		}
+	}
+}
+
+func expand(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:start])
+		name, def, _ := strings.Cut(s[start+2:start+end], ":")
+		if v, ok := os.LookupEnv(name); ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(def)
+		}
+		s = s[start+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeOverrides(t *testing.T) {
+	t.Setenv("REGISTRY_HOST", "10.0.0.1:6971")
+	t.Setenv("MICROGO_LOG_LEVEL", "warn")
+	t.Setenv("MICROGO_SERVER__DEMO_RPCSERVER__PORT", "9090")
+	t.Setenv("MICROGO_CLIENT__REQUEST_TIMEOUT", "2000")
+
+	conf, err := Decode(strings.NewReader(`
+log-level: info
+keep-alive: ${KEEP_ALIVE:20000}
+registry:
+  name: micro-route
+  data:
+    host: ${REGISTRY_HOST}
+server:
+  - name: demo.rpcServer
+    port: 8080
+    tags: [a]
+`), "server[demo.rpcServer].tags=b,c", "client.request-timeout=3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.KeepAlive != 20000 {
+		t.Fatalf("expect default of placeholder, got %d", conf.KeepAlive)
+	}
+	if conf.Registry.Data["host"] != "10.0.0.1:6971" {
+		t.Fatalf("expect env in placeholder, got %q", conf.Registry.Data["host"])
+	}
+	if conf.LogLevel != "warn" {
+		t.Fatalf("expect env override, got %q", conf.LogLevel)
+	}
+	srvConf := conf.GetServerConfig("demo.rpcServer")
+	if srvConf.Port != "9090" || strings.Join(srvConf.Tags, ",") != "b,c" {
+		t.Fatalf("unexpected server config %+v", srvConf)
+	}
+	// the overrides take precedence over the environment
+	if conf.ClientConf.RequestTimeout != 3000*1e6 {
+		t.Fatalf("expect override, got %d", conf.ClientConf.RequestTimeout)
+	}
+
+	// the environment cannot add a server, an override can
+	conf, err = Decode(strings.NewReader(""), "base-dir=/tmp", "server[other].port=7070")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.BaseDir != "/tmp" || len(conf.ServerConf) != 1 || conf.GetServerConfig("other").Port != "7070" {
+		t.Fatalf("unexpected config %+v", conf)
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diff returns the paths of the fields different in old and new, named
+// after their yaml keys, the servers and the client targets by name, e.g.
+// log-level, client.request-timeout, server[demo.rpcServer].max-invoke or
+// clients[demo.rpcServer].request-timeout.
+func Diff(old, new *Config) ([]string, error) {
+	oldFields, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := flatten(new)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for key, v := range oldFields {
+		if nv, ok := newFields[key]; !ok || !reflect.DeepEqual(v, nv) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range newFields {
+		if _, ok := oldFields[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+func flatten(conf *Config) (map[string]any, error) {
+	bs, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]any)
+	if err := yaml.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]any)
+	flattenValue(fields, "", m)
+	return fields, nil
+}
+
+func flattenValue(fields map[string]any, prefix string, v any) {
+	switch value := v.(type) {
+	case map[string]any:
+		_, entries := entryKeys[prefix]
+		for k, item := range value {
+			key := k
+			if entries {
+				key = prefix + "[" + k + "]"
+			} else if len(prefix) > 0 {
+				key = prefix + "." + k
+			}
+			flattenValue(fields, key, item)
+		}
+	case []any:
+		if prefix != "server" {
+			fields[prefix] = value
+			return
+		}
+		for i, item := range value {
+			name := fmt.Sprint(i)
+			if srv, ok := item.(map[string]any); ok {
+				name = fmt.Sprint(srv["name"])
+			}
+			flattenValue(fields, fmt.Sprintf("%s[%s]", prefix, name), item)
+		}
+	default:
+		fields[prefix] = value
+	}
+}
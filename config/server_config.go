@@ -3,7 +3,8 @@ package config
 import "time"
 
 const (
-	maxInvokeNum = 10000
+	maxInvokeNum  = 10000
+	defaultWeight = 100
 )
 
 type ServerConfig struct {
@@ -11,14 +12,23 @@ type ServerConfig struct {
 	Port          string `yaml:"port"`
 	InvokeTimeout int64  `yaml:"invoke-timeout"`
 	MaxInvoke     int64  `yaml:"max-invoke"`
+
+	// published with the instance to the registry
+	Weight  int64             `yaml:"weight"`
+	Version string            `yaml:"version"`
+	Zone    string            `yaml:"zone"`
+	Region  string            `yaml:"region"`
+	Tags    []string          `yaml:"tags"`
+	Labels  map[string]string `yaml:"labels"`
 }
 
 func loadServerConfig(conf *ServerConfig) *ServerConfig {
 	if conf == nil {
 		return conf
 	}
-	conf.InvokeTimeout = getValue(conf.InvokeTimeout, 1000, 0) * int64(time.Millisecond)
+	conf.InvokeTimeout = getValue(conf.InvokeTimeout, 1, 0) * int64(time.Millisecond)
 	conf.MaxInvoke = getValue(conf.MaxInvoke, 1, maxInvokeNum)
+	conf.Weight = getValue(conf.Weight, 1, defaultWeight)
 	return conf
 }
 
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// FieldError is a bad setting, Path names the field as Diff does.
+type FieldError struct {
+	Path string
+	Msg  string
+}
+
+func (e *FieldError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationError reports every bad setting of a configuration at once.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, fe := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(fe.Error())
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Add(path, format string, args ...any) {
+	e.Errors = append(e.Errors, &FieldError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e, or nil when it holds no error.
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks the settings of conf, the returned error is a
+// *ValidationError naming every bad field.
+func Validate(conf *Config) error {
+	errs := &ValidationError{}
+	validate(conf, errs)
+	return errs.Err()
+}
+
+func validate(conf *Config, errs *ValidationError) {
+	if len(conf.LogLevel) > 0 {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(conf.LogLevel)); err != nil {
+			errs.Add("log-level", "unknown level %q", conf.LogLevel)
+		}
+	}
+	if len(conf.AppListen) > 0 {
+		if _, port, err := net.SplitHostPort(conf.AppListen); err != nil || !validPort(port, true) {
+			errs.Add("app-listen", "invalid address %q, expect host:port", conf.AppListen)
+		}
+	}
+	nonNegative(errs, "keep-alive", int64(conf.KeepAlive))
+	nonNegative(errs, "readiness-failure-timeout", int64(conf.ReadinessFailureTimeout))
+	nonNegative(errs, "reload-interval", int64(conf.ReloadInterval))
+
+	validateRegistry(errs, "registry", conf.Registry)
+	for i, rc := range conf.Registries {
+		validateRegistry(errs, fmt.Sprintf("registries[%d]", i), rc)
+	}
+	validateRegistry(errs, "discovery", conf.Discovery)
+
+	names := make(map[string]struct{}, len(conf.ServerConf))
+	for i, srvConf := range conf.ServerConf {
+		if srvConf == nil || len(srvConf.Name) == 0 {
+			errs.Add(fmt.Sprintf("server[%d].name", i), "required")
+			continue
+		}
+		path := "server[" + srvConf.Name + "]"
+		if _, ok := names[srvConf.Name]; ok {
+			errs.Add(path, "duplicate server name")
+		}
+		names[srvConf.Name] = struct{}{}
+		if len(srvConf.Port) == 0 {
+			errs.Add(path+".port", "required")
+		} else if !validPort(srvConf.Port, false) {
+			errs.Add(path+".port", "invalid port %q, expect 1-65535", srvConf.Port)
+		}
+		nonNegative(errs, path+".invoke-timeout", srvConf.InvokeTimeout)
+		nonNegative(errs, path+".max-invoke", srvConf.MaxInvoke)
+		nonNegative(errs, path+".weight", srvConf.Weight)
+	}
+
+	validateClient(errs, "client", conf.ClientConf)
+	if conf.ClientConf != nil && len(conf.ClientConf.Hosts) > 0 {
+		errs.Add("client.hosts", "static hosts are set by target, in clients")
+	}
+	targets := make([]string, 0, len(conf.Clients))
+	for name := range conf.Clients {
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+	for _, name := range targets {
+		validateClient(errs, "clients["+name+"]", conf.Clients[name])
+	}
+}
+
+func validateClient(errs *ValidationError, path string, cc *ClientConfig) {
+	if cc == nil {
+		return
+	}
+	nonNegative(errs, path+".request-timeout", cc.RequestTimeout)
+	nonNegative(errs, path+".refresh-endpoint-interval", cc.RefreshEndpointInterval)
+	nonNegative(errs, path+".broadcast-concurrency", cc.BroadcastConcurrency)
+	nonNegative(errs, path+".pool-size", cc.PoolSize)
+	nonNegative(errs, path+".dial-timeout", cc.DialTimeout)
+	nonNegative(errs, path+".max-requests-per-conn", cc.MaxRequestsPerConn)
+	nonNegative(errs, path+".empty-route-threshold", cc.EmptyRouteThreshold)
+	if cc.ZoneSpillThreshold < 0 || cc.ZoneSpillThreshold > 100 {
+		errs.Add(path+".zone-spill-threshold", "must be a percentage, got %d", cc.ZoneSpillThreshold)
+	}
+	switch cc.Balancer {
+	case "", BalancerRoundRobin, BalancerRandom:
+	default:
+		errs.Add(path+".balancer", "unknown balancer %q, expect %s or %s", cc.Balancer, BalancerRoundRobin, BalancerRandom)
+	}
+	if cc.Retry != nil {
+		nonNegative(errs, path+".retry.max-attempts", cc.Retry.MaxAttempts)
+		nonNegative(errs, path+".retry.backoff", cc.Retry.Backoff)
+	}
+	if cc.CircuitBreaker != nil {
+		nonNegative(errs, path+".circuit-breaker.failure-threshold", cc.CircuitBreaker.FailureThreshold)
+		nonNegative(errs, path+".circuit-breaker.open-timeout", cc.CircuitBreaker.OpenTimeout)
+	}
+	for i, host := range cc.Hosts {
+		if _, port, err := net.SplitHostPort(host); err != nil || !validPort(port, false) {
+			errs.Add(fmt.Sprintf("%s.hosts[%d]", path, i), "invalid host %q, expect host:port", host)
+		}
+	}
+}
+
+func validateRegistry(errs *ValidationError, path string, rc *Registry) {
+	if rc != nil && len(rc.Name) == 0 {
+		errs.Add(path+".name", "required")
+	}
+}
+
+func nonNegative(errs *ValidationError, path string, v int64) {
+	if v < 0 {
+		errs.Add(path, "must not be negative, got %d", v)
+	}
+}
+
+func validPort(port string, allowZero bool) bool {
+	p, err := strconv.Atoi(port)
+	if err != nil || p > 65535 {
+		return false
+	}
+	return p > 0 || allowZero && p == 0
+}
+
+// checkFields reports the keys of node unknown to the type t decoded from it.
+func checkFields(errs *ValidationError, node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldPath := key.Value
+			if len(path) > 0 {
+				fieldPath = path + "." + key.Value
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				if key.Line > 0 {
+					errs.Add(fieldPath, "unknown field (line %d)", key.Line)
+				} else {
+					errs.Add(fieldPath, "unknown field")
+				}
+				continue
+			}
+			checkFields(errs, node.Content[i+1], ft, fieldPath)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			checkFields(errs, item, t.Elem(), fmt.Sprintf("%s[%s]", path, entryName(item, i)))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkFields(errs, node.Content[i+1], t.Elem(), path+"["+node.Content[i].Value+"]")
+		}
+	}
+}
+
+// yamlFields returns the types of the fields of the struct t by yaml key.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// knownEnvPath reports whether the keys of an environment variable, in their
+// envKey form, name a field of t.
+func knownEnvPath(t reflect.Type, segs []string) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if len(segs) == 0 {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for name, ft := range yamlFields(t) {
+			if envKey(name) == segs[0] {
+				return knownEnvPath(ft, segs[1:])
+			}
+		}
+		return false
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Pointer || t.Elem().Kind() == reflect.Struct {
+			return knownEnvPath(t.Elem(), segs[1:])
+		}
+		return len(segs) == 0
+	case reflect.Map:
+		if len(segs) > 1 {
+			return knownEnvPath(t.Elem(), segs[1:])
+		}
+		return true
+	}
+	return len(segs) == 0
+}
+
+func entryName(item *yaml.Node, i int) string {
+	for j := 0; j+1 < len(item.Content); j += 2 {
+		if item.Content[j].Value == "name" {
+			return item.Content[j+1].Value
+		}
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeInvalid(t *testing.T) {
+	t.Setenv("MICROGO_HOME", "/root")
+
+	_, err := Decode(strings.NewReader(`
+log-level: loud
+client:
+  request-timout: 3000
+registry:
+  data:
+    host: 127.0.0.1:6971
+server:
+  - name: demo.rpcServer
+    port: 80800
+  - name: demo.rpcServer
+    port: 8081
+    invoke-timeout: -1
+`))
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expect validation error, got %v", err)
+	}
+	want := []string{
+		"client.request-timout: unknown field (line 4)",
+		"log-level: unknown level",
+		"registry.name: required",
+		"server[demo.rpcServer].port: invalid port",
+		"server[demo.rpcServer]: duplicate server name",
+		"server[demo.rpcServer].invoke-timeout: must not be negative",
+	}
+	if len(ve.Errors) != len(want) {
+		t.Fatalf("expect %d errors, got %v", len(want), err)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("missing %q in %v", w, err)
+		}
+	}
+}
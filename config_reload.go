@@ -0,0 +1,243 @@
+package microgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrNoConfigFile = fmt.Errorf("config not loaded from a file")
+
+// ConfigEvent describes a reload of the configuration. Changed lists the
+// changed fields, named as by config.Diff, Applied those applied live and
+// RestartRequired those taking effect only after a restart.
+type ConfigEvent struct {
+	Old             *config.Config `json:"-"`
+	New             *config.Config `json:"-"`
+	Changed         []string       `json:"changed"`
+	Applied         []string       `json:"applied"`
+	RestartRequired []string       `json:"restart-required"`
+}
+
+// OnConfigChange subscribes fn to the reloads of the default application.
+func OnConfigChange(fn func(event *ConfigEvent)) {
+	DefaultApplication().OnConfigChange(fn)
+}
+
+// OnConfigChange subscribes fn to the reloads changing the configuration,
+// it is called once the changes are applied.
+func (app *Application) OnConfigChange(fn func(event *ConfigEvent)) {
+	app.reloadMu.Lock()
+	app.configListeners = append(app.configListeners, fn)
+	app.reloadMu.Unlock()
+}
+
+// Reload reads the configuration file again and applies the fields that can
+// change while running: log-level, reload-interval, the invoke-timeout and
+// max-invoke of the servers and the request-timeout and
+// refresh-endpoint-interval of the clients. The other changes are reported
+// and kept for the next start. The listeners are called once the reload is
+// done, they may reload again.
+func (app *Application) Reload() (*ConfigEvent, error) {
+	event, listeners, err := app.reload()
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range listeners {
+		fn(event)
+	}
+	return event, nil
+}
+
+// reload applies the configuration file, it returns the listeners to notify
+// of the event when it changed.
+func (app *Application) reload() (*ConfigEvent, []func(event *ConfigEvent), error) {
+	app.reloadMu.Lock()
+	defer app.reloadMu.Unlock()
+
+	old := app.Config()
+	if len(old.Path()) == 0 {
+		return nil, nil, ErrNoConfigFile
+	}
+	conf, err := config.Load(old.Path(), old.Overrides()...)
+	if err != nil {
+		return nil, nil, err
+	}
+	changed, err := config.Diff(old, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	event := &ConfigEvent{Old: old, New: old, Changed: changed}
+	if len(changed) == 0 {
+		return event, nil, nil
+	}
+
+	merged := *old
+	clientConf := *old.ClientConf
+	merged.ClientConf = &clientConf
+	merged.Clients = make(map[string]*config.ClientConfig, len(old.Clients))
+	for name, cc := range old.Clients {
+		targetConf := *cc
+		merged.Clients[name] = &targetConf
+	}
+	merged.ServerConf = make([]*config.ServerConfig, len(old.ServerConf))
+	copy(merged.ServerConf, old.ServerConf)
+	reloadServers := make(map[string]*config.ServerConfig)
+
+	for _, field := range changed {
+		applied := true
+		switch field {
+		case "log-level":
+			merged.LogLevel = conf.LogLevel
+		case "reload-interval":
+			merged.ReloadInterval = conf.ReloadInterval
+		default:
+			applied = reloadClientField(&merged, conf, field) || app.reloadServerField(&merged, conf, field, reloadServers)
+		}
+		if applied {
+			event.Applied = append(event.Applied, field)
+		} else {
+			event.RestartRequired = append(event.RestartRequired, field)
+		}
+	}
+	event.New = &merged
+	app.conf.Store(&merged)
+
+	if err := xlog.UpdateLevel(app.level, merged.LogLevel); err != nil {
+		xlog.Error(context.TODO(), "set log level failed", zap.Error(err))
+	}
+	app.clientMu.Lock()
+	for client := range app.clientMap {
+		client.conf.Store(merged.GetClientConfig(client.name))
+	}
+	app.clientMu.Unlock()
+	for name, srvConf := range reloadServers {
+		if srv, ok := app.serverMap[name].(appServer); ok {
+			srv.reloadConfig(srvConf)
+		}
+	}
+
+	xlog.Info(context.TODO(), "reload config", zap.Strings("applied", event.Applied), zap.Strings("restartRequired", event.RestartRequired))
+	listeners := make([]func(event *ConfigEvent), len(app.configListeners))
+	copy(listeners, app.configListeners)
+	return event, listeners, nil
+}
+
+// reloadClientField applies the change of a live field of the client block
+// or of a client target. The targets take the value of the new configuration,
+// where they inherit the client block, so that a change of the block reaches
+// the targets not setting the field.
+func reloadClientField(merged, conf *config.Config, field string) bool {
+	var key string
+	switch {
+	case strings.HasPrefix(field, "client."):
+		key = strings.TrimPrefix(field, "client.")
+	case strings.HasPrefix(field, "clients["):
+		name, rest, ok := strings.Cut(strings.TrimPrefix(field, "clients["), "].")
+		if !ok || merged.Clients[name] == nil || conf.Clients[name] == nil {
+			return false
+		}
+		key = rest
+	default:
+		return false
+	}
+
+	var set func(dst, src *config.ClientConfig)
+	switch key {
+	case "request-timeout":
+		set = func(dst, src *config.ClientConfig) { dst.RequestTimeout = src.RequestTimeout }
+	case "refresh-endpoint-interval":
+		set = func(dst, src *config.ClientConfig) { dst.RefreshEndpointInterval = src.RefreshEndpointInterval }
+	default:
+		return false
+	}
+	set(merged.ClientConf, conf.ClientConf)
+	for name, cc := range merged.Clients {
+		if newConf, ok := conf.Clients[name]; ok {
+			set(cc, newConf)
+		}
+	}
+	return true
+}
+
+// reloadServerField applies the change of a live field of a server that is
+// running, it reports whether the field could be applied.
+func (app *Application) reloadServerField(merged, conf *config.Config, field string, reloadServers map[string]*config.ServerConfig) bool {
+	if !strings.HasPrefix(field, "server[") {
+		return false
+	}
+	end := strings.Index(field, "].")
+	if end < 0 {
+		return false
+	}
+	name, key := field[len("server["):end], field[end+2:]
+	if key != "invoke-timeout" && key != "max-invoke" {
+		return false
+	}
+	for i, oldConf := range merged.ServerConf {
+		if oldConf.Name != name {
+			continue
+		}
+		srvConf, ok := reloadServers[name]
+		if !ok {
+			copied := *oldConf
+			srvConf = &copied
+			reloadServers[name] = srvConf
+			merged.ServerConf[i] = srvConf
+		}
+		newConf := conf.GetServerConfig(name)
+		if key == "invoke-timeout" {
+			srvConf.InvokeTimeout = newConf.InvokeTimeout
+		} else {
+			srvConf.MaxInvoke = newConf.MaxInvoke
+		}
+		return true
+	}
+	return false
+}
+
+// watchConfig reloads the configuration whenever its file changes.
+func (app *Application) watchConfig() {
+	path := app.Config().Path()
+	if len(path) == 0 {
+		return
+	}
+	last, _ := os.ReadFile(path)
+	for {
+		timer := time.NewTimer(time.Duration(app.Config().ReloadInterval) * time.Millisecond)
+		select {
+		case <-app.doneCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		bs, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(bs, last) {
+			continue
+		}
+		last = bs
+		if _, err := app.Reload(); err != nil {
+			xlog.Error(context.TODO(), "reload config failed", zap.String("path", path), zap.Error(err))
+		}
+	}
+}
+
+func (app *Application) reloadConfig(writer http.ResponseWriter, request *http.Request) {
+	event, err := app.Reload()
+	if err != nil {
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(err.Error()))
+		return
+	}
+	bs, _ := json.Marshal(event)
+	writer.Header().Set("content-type", "application/json;charset=utf-8")
+	writer.Write(bs)
+}
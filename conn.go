@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -29,6 +30,9 @@ var (
 	ErrFullBodyLen           = fmt.Errorf("full body lenght")
 	ErrBadConnection         = fmt.Errorf("bad connection")
 	ErrNotFoundConnection    = fmt.Errorf("not found connection")
+	ErrConnectionLost        = fmt.Errorf("connection lost")
+	ErrConnectionBusy        = fmt.Errorf("connection busy")
+	ErrConnPoolClosed        = fmt.Errorf("connection pool closed")
 )
 
 type conn struct {
@@ -40,6 +44,10 @@ type conn struct {
 	lastErr    error
 	ip         string
 	isClosed   atomic.Bool
+
+	// pending holds the response channel of every request written on the
+	// connection and still waiting for its response, nil once the connection is dead.
+	pending map[uint32]chan *Message
 }
 
 func newConn(rw net.Conn) *conn {
@@ -47,6 +55,7 @@ func newConn(rw net.Conn) *conn {
 		rw:      rw,
 		readBuf: make([]byte, defaultReadBufSize),
 		headBuf: make([]byte, defaultHeadSize),
+		pending: make(map[uint32]chan *Message),
 	}
 	ip := net.ParseIP(rw.RemoteAddr().String())
 	c.ip = ip.String()
@@ -67,6 +76,60 @@ func (conn *conn) Close() error {
 	return nil
 }
 
+// healthy reports whether the connection can take new requests.
+func (conn *conn) healthy() bool {
+	if conn.isClosed.Load() {
+		return false
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.pending != nil && conn.lastErr == nil
+}
+
+func (conn *conn) pendingCount() int {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return len(conn.pending)
+}
+
+func (conn *conn) addPending(reqId uint32, ch chan *Message) bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.pending == nil {
+		return false
+	}
+	conn.pending[reqId] = ch
+	return true
+}
+
+func (conn *conn) removePending(reqId uint32) {
+	conn.mu.Lock()
+	delete(conn.pending, reqId)
+	conn.mu.Unlock()
+}
+
+func (conn *conn) takePending(reqId uint32) (chan *Message, bool) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	ch, ok := conn.pending[reqId]
+	if ok {
+		delete(conn.pending, reqId)
+	}
+	return ch, ok
+}
+
+// failPending closes the response channel of every outstanding request,
+// the callers see ErrConnectionLost instead of waiting for their timeout.
+func (conn *conn) failPending() {
+	conn.mu.Lock()
+	pending := conn.pending
+	conn.pending = nil
+	conn.mu.Unlock()
+	for _, ch := range pending {
+		close(ch)
+	}
+}
+
 func (conn *conn) readMessage() (*Message, error) {
 	headBuf := conn.headBuf[:]
 	_, err := io.ReadFull(conn.rw, headBuf)
@@ -128,41 +191,90 @@ func (conn *conn) sendMessage(msg *Message) (err error) {
 	copy(body[6:], dataBytes)
 
 	_, err = conn.rw.Write(body)
+	if err != nil {
+		conn.mu.Lock()
+		conn.lastErr = err
+		conn.mu.Unlock()
+		conn.Close()
+	}
 
 	return err
 }
 
 type clientConnPool struct {
-	client    *Client
-	mu        sync.Mutex
-	addr      string
-	dial      func(addr string) (net.Conn, error)
-	poolSize  int
-	index     int
-	idleConns []*conn
+	client     *Client
+	mu         sync.Mutex
+	addr       string
+	dial       func(addr string) (net.Conn, error)
+	poolSize   int
+	maxPending int
+	index      int
+	conns      []*conn
+	// dialing is the number of pool slots reserved by the dials in progress,
+	// which run without p.mu.
+	dialing int
+	closed  bool
 }
 
-func newClientConnPool(client *Client, addr string, size int) *clientConnPool {
+func newClientConnPool(client *Client, addr string) *clientConnPool {
 	p := &clientConnPool{
-		client:   client,
-		addr:     addr,
-		poolSize: size,
+		client:     client,
+		addr:       addr,
+		poolSize:   int(client.clientConfig().PoolSize),
+		maxPending: int(client.clientConfig().MaxRequestsPerConn),
 	}
+	dialTimeout := time.Duration(client.clientConfig().DialTimeout)
 	p.dial = func(addr string) (net.Conn, error) {
-		return net.Dial("tcp", addr)
+		return net.DialTimeout("tcp", addr, dialTimeout)
 	}
 	if p.poolSize <= 0 {
 		p.poolSize = runtime.NumCPU()
 	}
-	p.idleConns = make([]*conn, 0, p.poolSize)
+	p.conns = make([]*conn, 0, p.poolSize)
 	return p
 }
 
+// close stops handing out connections and closes them once their in-flight
+// requests are answered or the request timeout has passed.
 func (p *clientConnPool) close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	conns := p.conns
+	p.mu.Unlock()
 
+	go func() {
+		deadline := time.Now().Add(time.Duration(p.client.clientConfig().RequestTimeout))
+		for _, c := range conns {
+			for c.pendingCount() > 0 && time.Now().Before(deadline) {
+				time.Sleep(drainCheckInterval)
+			}
+			c.Close()
+		}
+	}()
 }
 
-const tryGetConnTimes = 3
+// shutdown closes every connection at once, the in-flight requests fail.
+func (p *clientConnPool) shutdown() {
+	p.mu.Lock()
+	p.closed = true
+	conns := p.conns
+	p.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+const (
+	tryGetConnTimes    = 3
+	replaceConnTimes   = 5
+	replaceConnBackoff = 100 * time.Millisecond
+	drainCheckInterval = 10 * time.Millisecond
+)
 
 func (p *clientConnPool) getConn() (*conn, error) {
 	for i := 0; i < tryGetConnTimes; i++ {
@@ -180,36 +292,91 @@ func (p *clientConnPool) getConn() (*conn, error) {
 
 func (p *clientConnPool) tryGetConn() (*conn, error) {
 	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrConnPoolClosed
+	}
+	if len(p.conns)+p.dialing < p.poolSize {
+		p.dialing++
+		p.mu.Unlock()
+		return p.dialConn()
+	}
 	defer p.mu.Unlock()
 
-	if len(p.idleConns) >= p.poolSize {
-		if p.index >= p.poolSize {
+	var busy bool
+	for i := 0; i < len(p.conns); i++ {
+		if p.index >= len(p.conns) {
 			p.index = 0
 		}
-		for {
-			c := p.idleConns[p.index]
-			p.index++
-			return c, nil
+		c := p.conns[p.index]
+		p.index++
+		if !c.healthy() {
+			continue
+		}
+		if p.maxPending > 0 && c.pendingCount() >= p.maxPending {
+			busy = true
+			continue
 		}
+		return c, nil
 	}
+	if busy {
+		return nil, ErrConnectionBusy
+	}
+	return nil, ErrBadConnection
+}
 
+// dialConn dials a connection for a slot reserved in p.dialing, without
+// p.mu, and adds it to the pool unless the pool was closed meanwhile.
+func (p *clientConnPool) dialConn() (*conn, error) {
 	rw, err := p.dial(p.addr)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialing--
 	if err != nil {
 		return nil, err
 	}
+	if p.closed {
+		rw.Close()
+		return nil, ErrConnPoolClosed
+	}
 	c := newConn(rw)
-	p.index++
-	p.idleConns = append(p.idleConns, c)
+	p.conns = append(p.conns, c)
 	go p.readMessage(c)
 	return c, nil
 }
 
+// replaceConn dials in the background until the pool is full again.
+func (p *clientConnPool) replaceConn() {
+	backoff := replaceConnBackoff
+	for i := 0; i < replaceConnTimes; i++ {
+		p.mu.Lock()
+		if p.closed || len(p.conns)+p.dialing >= p.poolSize {
+			p.mu.Unlock()
+			return
+		}
+		p.dialing++
+		p.mu.Unlock()
+		_, err := p.dialConn()
+		if err == nil {
+			return
+		}
+		xlog.Warn(context.TODO(), "replace connection failed", zap.String("addr", p.addr), zap.Error(err))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
 func (p *clientConnPool) readMessage(c *conn) {
-	defer p.removeConn(c)
+	defer func() {
+		p.removeConn(c)
+		c.Close()
+		c.failPending()
+	}()
 	for {
 		msg, err := c.readMessage()
 		if err != nil {
-			if err != io.EOF {
+			if err != io.EOF && !c.isClosed.Load() {
 				xlog.Error(context.TODO(), "client read message failed", zap.Error(err))
 			}
 			return
@@ -217,7 +384,11 @@ func (p *clientConnPool) readMessage(c *conn) {
 		switch msg.Type {
 		case MessageType_Ping:
 		case MessageType_Data:
-			p.client.handle(msg)
+			if ch, ok := c.takePending(msg.Data.RequestId); ok {
+				ch <- msg
+			} else {
+				putMessage(msg)
+			}
 		default:
 			xlog.Error(context.TODO(), "error message type", zap.Any("data type", msg.Type))
 			return
@@ -226,15 +397,20 @@ func (p *clientConnPool) readMessage(c *conn) {
 }
 
 func (p *clientConnPool) removeConn(c *conn) {
-	newConns := make([]*conn, 0, len(p.idleConns)-1)
 	p.mu.Lock()
-	for i := range p.idleConns {
-		ic := p.idleConns[i]
+	newConns := make([]*conn, 0, len(p.conns))
+	for i := range p.conns {
+		ic := p.conns[i]
 		if ic == c {
 			continue
 		}
 		newConns = append(newConns, ic)
 	}
-	p.idleConns = newConns
+	p.conns = newConns
+	closed := p.closed
 	p.mu.Unlock()
+
+	if !closed {
+		go p.replaceConn()
+	}
 }
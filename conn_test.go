@@ -0,0 +1,140 @@
+package microgo
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeDialer dials in-memory connections, the server ends are kept to drop
+// them.
+type pipeDialer struct {
+	mu      sync.Mutex
+	servers []net.Conn
+}
+
+func (d *pipeDialer) dial(addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	d.mu.Lock()
+	d.servers = append(d.servers, server)
+	d.mu.Unlock()
+	return client, nil
+}
+
+func (d *pipeDialer) dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.servers)
+}
+
+func newTestPool(t *testing.T, poolSize int) (*clientConnPool, *pipeDialer) {
+	t.Helper()
+	app := newTestApplication(t, "")
+	client := app.NewClient("demo.rpcServer", WithClientOptionHosts("127.0.0.1:1"))
+	t.Cleanup(func() { client.Close() })
+
+	d := &pipeDialer{}
+	p := newClientConnPool(client, "127.0.0.1:1")
+	p.poolSize = poolSize
+	p.dial = d.dial
+	t.Cleanup(p.shutdown)
+	return p, d
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	p, d := newTestPool(t, 2)
+	seen := make(map[*conn]struct{})
+	for i := 0; i < 10; i++ {
+		c, err := p.getConn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[c] = struct{}{}
+	}
+	if d.dials() != 2 || len(seen) != 2 {
+		t.Fatalf("expect 2 connections, dialed %d, used %d", d.dials(), len(seen))
+	}
+}
+
+func TestPoolReplaceUnhealthy(t *testing.T) {
+	p, d := newTestPool(t, 2)
+	first, err := p.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a connection failing a write is skipped
+	second.mu.Lock()
+	second.lastErr = net.ErrClosed
+	second.mu.Unlock()
+	for i := 0; i < 4; i++ {
+		if c, err := p.getConn(); err != nil || c != first {
+			t.Fatalf("expect the healthy connection, got %p, %v", c, err)
+		}
+	}
+
+	// a dropped connection fails its pending requests and is replaced
+	ch := make(chan *Message, 1)
+	if !first.addPending(1, ch) {
+		t.Fatal("expect the request added")
+	}
+	d.mu.Lock()
+	d.servers[0].Close()
+	d.mu.Unlock()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expect the pending request failed")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("pending request not failed")
+	}
+	waitFor(t, "dropped connection not replaced", func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, c := range p.conns {
+			if c == first {
+				return false
+			}
+		}
+		return len(p.conns) == 2 && d.dials() == 3
+	})
+}
+
+func TestPoolDrainOnClose(t *testing.T) {
+	p, _ := newTestPool(t, 1)
+	c, err := p.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.addPending(1, make(chan *Message, 1)) {
+		t.Fatal("expect the request added")
+	}
+
+	p.close()
+	if _, err := p.getConn(); err != ErrConnPoolClosed {
+		t.Fatalf("expect ErrConnPoolClosed, got %v", err)
+	}
+	time.Sleep(5 * drainCheckInterval)
+	if c.isClosed.Load() {
+		t.Fatal("connection closed with a request in flight")
+	}
+	c.removePending(1)
+	waitFor(t, "drained connection not closed", c.isClosed.Load)
+}
@@ -1,19 +1,175 @@
 package microgo
 
 import (
+	"context"
+	"fmt"
 	"github.com/YCloud160/microgo/config"
 	discovery2 "github.com/YCloud160/microgo/internal/discovery"
+	"github.com/YCloud160/microgo/internal/dns"
+	"github.com/YCloud160/microgo/naming"
+	"net"
+	"strconv"
+	"time"
 )
 
 type Discovery interface {
+	QueryRoute(name string) ([]*naming.Instance, error)
+}
+
+// Watcher is implemented by the discoveries able to push the instances of a
+// service whenever they change. The channel must be closed when ctx is done,
+// the client falls back to polling QueryRoute when it is closed earlier.
+type Watcher interface {
+	Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error)
+}
+
+// AddrDiscovery is the former form of Discovery returning only the addresses
+// of the instances, see DiscoveryFromAddr.
+type AddrDiscovery interface {
 	QueryRoute(name string) ([]string, error)
 }
 
-var discovery Discovery
+// DiscoveryFromAddr adapts an AddrDiscovery to Discovery.
+func DiscoveryFromAddr(d AddrDiscovery) Discovery {
+	return &addrDiscovery{d: d}
+}
+
+type addrDiscovery struct {
+	d AddrDiscovery
+}
+
+func (ad *addrDiscovery) QueryRoute(name string) ([]*naming.Instance, error) {
+	hosts, err := ad.d.QueryRoute(name)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]*naming.Instance, 0, len(hosts))
+	for _, host := range hosts {
+		instances = append(instances, &naming.Instance{Name: name, Addr: host, Weight: naming.DefaultWeight})
+	}
+	return instances, nil
+}
+
+// DiscoveryBuilder creates the discovery described by conf, conf.Data holds
+// the settings of the backend.
+type DiscoveryBuilder func(conf *config.Registry) (Discovery, error)
+
+const defaultFileWatchInterval = 500 * time.Millisecond
+
+// appDiscoveryBuilder is a DiscoveryBuilder given the application, for the
+// backends holding state owned by it.
+type appDiscoveryBuilder func(app *Application, conf *config.Registry) (Discovery, error)
+
+var (
+	discoveryBuilders = make(map[string]appDiscoveryBuilder)
+)
+
+func init() {
+	RegisterDiscoveryBuilder("micro-route", func(conf *config.Registry) (Discovery, error) {
+		return discovery2.NewMicroDiscovery(conf.Data["host"]), nil
+	})
+	RegisterDiscoveryBuilder("file", func(conf *config.Registry) (Discovery, error) {
+		interval := defaultFileWatchInterval
+		if v, err := strconv.ParseInt(conf.Data["watch-interval"], 10, 64); err == nil && v > 0 {
+			interval = time.Duration(v) * time.Millisecond
+		}
+		return discovery2.NewFileDiscovery(fileRegistryPath(conf), interval), nil
+	})
+	RegisterDiscoveryBuilder("consul", func(conf *config.Registry) (Discovery, error) {
+		return discovery2.NewConsulDiscovery(newConsulClient(conf)), nil
+	})
+	RegisterDiscoveryBuilder("dns", newDNSDiscovery)
+	discoveryBuilders["gossip"] = func(app *Application, conf *config.Registry) (Discovery, error) {
+		node, err := app.gossipNode(conf)
+		if err != nil {
+			return nil, err
+		}
+		return discovery2.NewGossipDiscovery(node), nil
+	}
+}
+
+const (
+	defaultDNSTimeout = 2 * time.Second
+	defaultDNSMinTTL  = time.Second
+	defaultDNSMaxTTL  = time.Minute
+)
 
-func initDiscovery(conf *config.Registry) {
-	switch conf.Name {
-	case "micro-route":
-		discovery = discovery2.NewMicroDiscovery(conf.Data["host"])
+// newDNSDiscovery creates the dns discovery, data.resolver is the address of
+// the name server, /etc/resolv.conf by default. data.mode is a for the A/AAAA
+// records of the name, with the port data.port, or srv for its SRV records.
+// data.domain is the name queried, {name} is replaced by the name of the
+// client. data.timeout, data.min-ttl and data.max-ttl are in milliseconds.
+func newDNSDiscovery(conf *config.Registry) (Discovery, error) {
+	client := &dns.Client{
+		Server:  conf.Data["resolver"],
+		Timeout: defaultDNSTimeout,
+		Mode:    conf.Data["mode"],
+		Domain:  conf.Data["domain"],
+		MinTTL:  defaultDNSMinTTL,
+		MaxTTL:  defaultDNSMaxTTL,
+	}
+	if len(client.Server) == 0 {
+		client.Server = dns.DefaultServer()
+	} else if _, _, err := net.SplitHostPort(client.Server); err != nil {
+		client.Server = net.JoinHostPort(client.Server, "53")
+	}
+	switch client.Mode {
+	case "":
+		client.Mode = dns.ModeA
+	case dns.ModeA, dns.ModeSRV:
+	default:
+		return nil, fmt.Errorf("unknown dns mode %q", client.Mode)
 	}
+	if client.Mode == dns.ModeA {
+		port, err := strconv.Atoi(conf.Data["port"])
+		if err != nil || port <= 0 {
+			return nil, fmt.Errorf("invalid dns port %q", conf.Data["port"])
+		}
+		client.Port = port
+	}
+	for key, d := range map[string]*time.Duration{
+		"timeout": &client.Timeout,
+		"min-ttl": &client.MinTTL,
+		"max-ttl": &client.MaxTTL,
+	} {
+		if v, err := strconv.ParseInt(conf.Data[key], 10, 64); err == nil && v > 0 {
+			*d = time.Duration(v) * time.Millisecond
+		}
+	}
+	return discovery2.NewDNSDiscovery(client), nil
+}
+
+// RegisterDiscoveryBuilder makes the discovery backend available under name
+// in the discovery configuration. It must be called before the first client
+// is created.
+func RegisterDiscoveryBuilder(name string, builder DiscoveryBuilder) {
+	builderMu.Lock()
+	defer builderMu.Unlock()
+	discoveryBuilders[name] = func(_ *Application, conf *config.Registry) (Discovery, error) {
+		return builder(conf)
+	}
+}
+
+// getDiscovery builds the discovery on first use, from the discovery block of
+// the configuration or else from the registry block. It is nil when neither is set.
+func (app *Application) getDiscovery() (Discovery, error) {
+	app.initDiscoveryOnce.Do(func() {
+		conf := app.Config()
+		dc := conf.Discovery
+		if dc == nil {
+			dc = conf.Registry
+		}
+		if dc == nil {
+			return
+		}
+		builderMu.Lock()
+		builder, ok := discoveryBuilders[dc.Name]
+		builderMu.Unlock()
+		if !ok {
+			app.discoveryErr = fmt.Errorf("unknown discovery %q", dc.Name)
+			return
+		}
+		app.discovery, app.discoveryErr = builder(app, dc)
+	})
+	return app.discovery, app.discoveryErr
 }
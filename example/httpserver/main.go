@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"github.com/YCloud160/microgo"
 	"net/http"
 )
 
 func main() {
+	flag.Parse()
 	mux := http.NewServeMux()
 	mux.HandleFunc("/test", func(writer http.ResponseWriter, request *http.Request) {
 		writer.Write([]byte("hello microgo"))
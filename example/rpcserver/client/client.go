@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"github.com/YCloud160/microgo/example/rpcserver/model"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
@@ -10,6 +11,7 @@ import (
 )
 
 func main() {
+	flag.Parse()
 	client := model.NewGreetObjClient("demo.rpcServer")
 	wg := sync.WaitGroup{}
 	for i := 0; i < 10; i++ {
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"flag"
 	"github.com/YCloud160/microgo"
 	"github.com/YCloud160/microgo/example/rpcserver/handle"
 	"github.com/YCloud160/microgo/example/rpcserver/model"
 )
 
 func main() {
+	flag.Parse()
 	server := microgo.NewTCPServer("demo.rpcServer", &handle.HelloServer{}, model.GreetObjCall)
 	microgo.RegisterServer(server)
 	microgo.Run()
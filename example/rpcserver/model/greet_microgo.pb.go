@@ -47,28 +47,51 @@ func GreetObjCall(ctx context.Context, impl any, enc microgo.Encoder, method str
 	return out, nil
 }
 
-// greetObjClient implement
-type greetObjClient struct {
+// GreetObjClient implement
+type GreetObjClient struct {
 	client *microgo.Client
 }
 
-func NewGreetObjClient(name string, options ...microgo.ClientOption) *greetObjClient {
+func NewGreetObjClient(name string, options ...microgo.ClientOption) *GreetObjClient {
 	client := microgo.NewClient(name, options...)
-	return &greetObjClient{client: client}
+	return &GreetObjClient{client: client}
 }
 
-func (client *greetObjClient) SayHello(ctx context.Context, req *SayHelloReq) (*SayHelloResp, error) {
-	input, err := proto.Marshal(req)
-	if err != nil {
+// Close releases the connections of the client.
+func (client *GreetObjClient) Close() error {
+	return client.client.Close()
+}
+
+func (client *GreetObjClient) SayHello(ctx context.Context, req *SayHelloReq, opts ...microgo.CallOption) (*SayHelloResp, error) {
+	resp := SayHelloResp{}
+	if err := client.client.Invoke(ctx, "SayHello", req, &resp, opts...); err != nil {
 		return nil, err
 	}
-	out, err := client.client.Call(ctx, "", "proto", "SayHello", input)
+	return &resp, nil
+}
+
+func (client *GreetObjClient) SayHelloAsync(ctx context.Context, req *SayHelloReq, callback func(*SayHelloResp, error), opts ...microgo.CallOption) *microgo.TypedFuture[*SayHelloResp] {
+	return microgo.Async(ctx, func(ctx context.Context) (*SayHelloResp, error) {
+		return client.SayHello(ctx, req, opts...)
+	}, callback)
+}
+
+func (client *GreetObjClient) BroadcastSayHello(ctx context.Context, req *SayHelloReq, opts ...microgo.BroadcastOption) ([]*microgo.BroadcastReply[*SayHelloResp], error) {
+	input, err := proto.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
-	resp := SayHelloResp{}
-	if err := proto.Unmarshal(out, &resp); err != nil {
-		return nil, err
+	results, err := client.client.BroadcastCall(ctx, "proto", "SayHello", input, opts...)
+	replies := make([]*microgo.BroadcastReply[*SayHelloResp], 0, len(results))
+	for _, res := range results {
+		reply := &microgo.BroadcastReply[*SayHelloResp]{Host: res.Host, Err: res.Err, Latency: res.Latency}
+		if res.Err == nil {
+			resp := SayHelloResp{}
+			if reply.Err = proto.Unmarshal(res.Out, &resp); reply.Err == nil {
+				reply.Resp = &resp
+			}
+		}
+		replies = append(replies, reply)
 	}
-	return &resp, nil
+	return replies, err
 }
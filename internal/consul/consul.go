@@ -0,0 +1,359 @@
+// Package consul talks to the HTTP API of a Consul agent for the consul
+// registry and discovery.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/YCloud160/microgo/naming"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// metaPrefix marks the service meta keys holding the instance fields
+	// Consul has no place for, the other keys are the instance labels.
+	metaPrefix = "microgo-"
+
+	// WaitTime is how long the agent holds a blocking query without change.
+	WaitTime = 30 * time.Second
+	// DefaultTimeout bounds the requests to the agent, a blocking query is
+	// given WaitTime more.
+	DefaultTimeout    = 10 * time.Second
+	watchRetryBackoff = time.Second
+	watchMaxBackoff   = 30 * time.Second
+)
+
+type Weights struct {
+	Passing int `json:"Passing"`
+	Warning int `json:"Warning"`
+}
+
+type Check struct {
+	CheckID                        string `json:"CheckID,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+type Service struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Service"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Weights *Weights          `json:"Weights,omitempty"`
+}
+
+// registration is the body of /v1/agent/service/register, it names the
+// service Name where the health entries name it Service.
+type registration struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Weights *Weights          `json:"Weights,omitempty"`
+	Check   *Check            `json:"Check,omitempty"`
+}
+
+type Node struct {
+	Node       string `json:"Node"`
+	Address    string `json:"Address"`
+	Datacenter string `json:"Datacenter"`
+}
+
+// ServiceEntry is an item of /v1/health/service/:name.
+type ServiceEntry struct {
+	Node    *Node    `json:"Node"`
+	Service *Service `json:"Service"`
+}
+
+// Client is a client of the agent at Host, Token and Datacenter are optional.
+type Client struct {
+	Host       string
+	Token      string
+	Datacenter string
+	// TTL is the ttl of the check of the registered services, DeregisterAfter
+	// how long a service may stay critical before the agent removes it.
+	TTL             time.Duration
+	DeregisterAfter time.Duration
+	// Timeout bounds each request, DefaultTimeout when zero.
+	Timeout time.Duration
+}
+
+// ServiceID is the id of the instance in Consul.
+func ServiceID(ins *naming.Instance) string {
+	return ins.Name + "-" + strings.ReplaceAll(ins.Addr, ":", "-")
+}
+
+func checkID(ins *naming.Instance) string {
+	return "service:" + ServiceID(ins)
+}
+
+// Register registers the instance with a TTL check and passes the check at
+// once, the instance would stay critical until the first keepalive otherwise.
+func (c *Client) Register(ins *naming.Instance) error {
+	host, portStr, err := net.SplitHostPort(ins.Addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	weight := ins.Weight
+	if weight <= 0 {
+		weight = naming.DefaultWeight
+	}
+	reg := &registration{
+		ID:      ServiceID(ins),
+		Name:    ins.Name,
+		Address: host,
+		Port:    port,
+		Tags:    ins.Tags,
+		Meta:    toMeta(ins),
+		Weights: &Weights{Passing: weight, Warning: 1},
+		Check: &Check{
+			CheckID:                        checkID(ins),
+			TTL:                            c.TTL.String(),
+			DeregisterCriticalServiceAfter: c.DeregisterAfter.String(),
+		},
+	}
+	if _, err := c.do(context.TODO(), http.MethodPut, "/v1/agent/service/register", nil, reg, nil); err != nil {
+		return err
+	}
+	return c.KeepAlive(ins)
+}
+
+func (c *Client) UnRegister(ins *naming.Instance) error {
+	_, err := c.do(context.TODO(), http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(ServiceID(ins)), nil, nil, nil)
+	return err
+}
+
+// KeepAlive passes the TTL check of the instance, it returns
+// naming.ErrUnknownInstance when the agent does not know the check anymore.
+func (c *Client) KeepAlive(ins *naming.Instance) error {
+	_, err := c.do(context.TODO(), http.MethodPut, "/v1/agent/check/pass/"+url.PathEscape(checkID(ins)), nil, nil, nil)
+	return err
+}
+
+func (c *Client) QueryRoute(name string) ([]*naming.Instance, error) {
+	instances, _, err := c.health(context.TODO(), name, 0)
+	return instances, err
+}
+
+// Watch runs blocking queries on the health of the service and pushes the
+// passing instances whenever they change. The channel is closed when ctx is done.
+func (c *Client) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	instances, index, err := c.health(ctx, name, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []*naming.Instance, 1)
+	ch <- instances
+	go func() {
+		defer close(ch)
+		last := naming.Signature(instances)
+		backoff := watchRetryBackoff
+		for {
+			instances, newIndex, err := c.health(ctx, name, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff *= 2; backoff > watchMaxBackoff {
+					backoff = watchMaxBackoff
+				}
+				continue
+			}
+			backoff = watchRetryBackoff
+			// the index must be reset when it goes backwards, e.g. after the
+			// agent restarted, see the blocking queries documentation.
+			if newIndex < index {
+				index = 0
+				continue
+			}
+			if newIndex == index {
+				continue
+			}
+			index = newIndex
+			// the index also moves on changes of the checks output
+			sig := naming.Signature(instances)
+			if sig == last {
+				continue
+			}
+			last = sig
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- instances:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// health returns the passing instances of the service and the index of the
+// answer, at least 1. A non zero index makes it a blocking query.
+func (c *Client) health(ctx context.Context, name string, index uint64) ([]*naming.Instance, uint64, error) {
+	query := url.Values{}
+	query.Set("passing", "true")
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", WaitTime.String())
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, WaitTime+c.timeout())
+		defer cancel()
+	}
+	var entries []*ServiceEntry
+	resp, err := c.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(name), query, nil, &entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	// a missing or zero index would make the next query return at once
+	if newIndex < 1 {
+		newIndex = 1
+	}
+
+	instances := make([]*naming.Instance, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Service == nil {
+			continue
+		}
+		address := entry.Service.Address
+		if len(address) == 0 && entry.Node != nil {
+			address = entry.Node.Address
+		}
+		instances = append(instances, fromService(entry.Service, address))
+	}
+	return instances, newIndex, nil
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if len(c.Datacenter) > 0 {
+		query.Set("dc", c.Datacenter)
+	}
+	u := "http://" + c.Host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(bs)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout())
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Token) > 0 {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(bs))
+		// older agents answer 500 to an unknown check
+		if resp.StatusCode == http.StatusNotFound || strings.Contains(msg, "Unknown check") {
+			if strings.HasPrefix(path, "/v1/agent/check/") {
+				return nil, naming.ErrUnknownInstance
+			}
+		}
+		return nil, fmt.Errorf("consul %s %s: %d %s", method, path, resp.StatusCode, msg)
+	}
+	if out != nil {
+		if err := json.Unmarshal(bs, out); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func toMeta(ins *naming.Instance) map[string]string {
+	m := make(map[string]string, len(ins.Labels)+4)
+	for k, v := range ins.Labels {
+		m[k] = v
+	}
+	for k, v := range map[string]string{
+		"protocol": ins.Protocol,
+		"version":  ins.Version,
+		"zone":     ins.Zone,
+		"region":   ins.Region,
+	} {
+		if len(v) > 0 {
+			m[metaPrefix+k] = v
+		}
+	}
+	return m
+}
+
+func fromService(srv *Service, address string) *naming.Instance {
+	ins := &naming.Instance{
+		Name:   srv.Name,
+		Addr:   net.JoinHostPort(address, strconv.Itoa(srv.Port)),
+		Weight: naming.DefaultWeight,
+		Tags:   srv.Tags,
+	}
+	if srv.Weights != nil && srv.Weights.Passing > 0 {
+		ins.Weight = srv.Weights.Passing
+	}
+	for k, v := range srv.Meta {
+		switch k {
+		case metaPrefix + "protocol":
+			ins.Protocol = v
+		case metaPrefix + "version":
+			ins.Version = v
+		case metaPrefix + "zone":
+			ins.Zone = v
+		case metaPrefix + "region":
+			ins.Region = v
+		default:
+			if ins.Labels == nil {
+				ins.Labels = make(map[string]string)
+			}
+			ins.Labels[k] = v
+		}
+	}
+	return ins
+}
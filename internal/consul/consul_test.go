@@ -0,0 +1,176 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+// fakeAgent serves the part of the agent API used by Client, a service is
+// passing once its check has been passed.
+type fakeAgent struct {
+	mu       sync.Mutex
+	index    uint64
+	changed  chan struct{}
+	services map[string]*registration
+	passing  map[string]bool
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{
+		index:    1,
+		changed:  make(chan struct{}),
+		services: make(map[string]*registration),
+		passing:  make(map[string]bool),
+	}
+}
+
+func (a *fakeAgent) bump() {
+	a.index++
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case path == "/v1/agent/service/register":
+		reg := &registration{}
+		if err := json.NewDecoder(r.Body).Decode(reg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.services[reg.ID] = reg
+		a.bump()
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		delete(a.services, id)
+		delete(a.passing, id)
+		a.bump()
+	case strings.HasPrefix(path, "/v1/agent/check/pass/service:"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/service:")
+		if _, ok := a.services[id]; !ok {
+			http.Error(w, "Unknown check ID", http.StatusNotFound)
+			return
+		}
+		if !a.passing[id] {
+			a.passing[id] = true
+			a.bump()
+		}
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index >= a.index {
+			changed := a.changed
+			a.mu.Unlock()
+			select {
+			case <-changed:
+			case <-time.After(time.Second):
+			}
+			a.mu.Lock()
+		}
+		entries := []*ServiceEntry{}
+		for id, reg := range a.services {
+			if reg.Name != name || !a.passing[id] {
+				continue
+			}
+			entries = append(entries, &ServiceEntry{
+				Node:    &Node{Node: "n1", Address: "10.0.0.1"},
+				Service: &Service{ID: reg.ID, Name: reg.Name, Address: reg.Address, Port: reg.Port, Tags: reg.Tags, Meta: reg.Meta, Weights: reg.Weights},
+			})
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(a.index, 10))
+		json.NewEncoder(w).Encode(entries)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRegisterAndWatch(t *testing.T) {
+	ts := httptest.NewServer(newFakeAgent())
+	defer ts.Close()
+	client := &Client{Host: strings.TrimPrefix(ts.URL, "http://"), TTL: 30 * time.Second, DeregisterAfter: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := client.Watch(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instances := <-ch; len(instances) != 0 {
+		t.Fatalf("expect no instance, got %v", instances)
+	}
+
+	ins := &naming.Instance{Name: "demo", Addr: "127.0.0.1:8080", Protocol: "tcp", Zone: "z1", Weight: 50, Labels: map[string]string{"env": "test"}}
+	if err := client.Register(ins); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case instances := <-ch:
+		if len(instances) != 1 {
+			t.Fatalf("expect 1 instance, got %v", instances)
+		}
+		got := instances[0]
+		if got.Addr != ins.Addr || got.Zone != "z1" || got.Protocol != "tcp" || got.Weight != 50 || got.Labels["env"] != "test" {
+			t.Fatalf("unexpected instance %+v", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch got no update")
+	}
+
+	if err := client.KeepAlive(ins); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UnRegister(ins); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.KeepAlive(ins); !errors.Is(err, naming.ErrUnknownInstance) {
+		t.Fatalf("keepalive of unknown instance: %v", err)
+	}
+	instances, err := client.QueryRoute("demo")
+	if err != nil || len(instances) != 0 {
+		t.Fatalf("expect no instance, got %v %v", instances, err)
+	}
+}
+
+func TestWatchWithoutIndex(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		// no X-Consul-Index, a blocking query is held a while
+		if len(r.URL.Query().Get("index")) > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{Host: strings.TrimPrefix(ts.URL, "http://")}
+	if _, err := c.Watch(ctx, "demo"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests > 10 {
+		t.Fatalf("watch spins without index: %d requests", requests)
+	}
+}
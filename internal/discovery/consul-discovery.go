@@ -0,0 +1,15 @@
+package discovery
+
+import (
+	"github.com/YCloud160/microgo/internal/consul"
+)
+
+// ConsulDiscovery returns the passing instances known by a Consul agent and
+// watches them with blocking queries.
+type ConsulDiscovery struct {
+	*consul.Client
+}
+
+func NewConsulDiscovery(client *consul.Client) *ConsulDiscovery {
+	return &ConsulDiscovery{Client: client}
+}
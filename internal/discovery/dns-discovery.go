@@ -0,0 +1,15 @@
+package discovery
+
+import (
+	"github.com/YCloud160/microgo/internal/dns"
+)
+
+// DNSDiscovery resolves the instances of a service from the A/AAAA or SRV
+// records of its name and watches them at the pace of the record ttl.
+type DNSDiscovery struct {
+	*dns.Client
+}
+
+func NewDNSDiscovery(client *dns.Client) *DNSDiscovery {
+	return &DNSDiscovery{Client: client}
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"context"
+	"github.com/YCloud160/microgo/internal/filestore"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+	"time"
+)
+
+// FileDiscovery reads the instances written by the file registry.
+type FileDiscovery struct {
+	Path string
+	// Interval is how often Watch checks the file.
+	Interval time.Duration
+}
+
+func NewFileDiscovery(path string, interval time.Duration) *FileDiscovery {
+	return &FileDiscovery{Path: path, Interval: interval}
+}
+
+func (fd *FileDiscovery) QueryRoute(name string) ([]*naming.Instance, error) {
+	return filestore.Alive(fd.Path, name)
+}
+
+// Watch checks the file every Interval and pushes the instances when the
+// alive set changes, which also covers the instances expiring.
+func (fd *FileDiscovery) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	instances, err := fd.QueryRoute(name)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan []*naming.Instance, 1)
+	ch <- instances
+	go func() {
+		defer close(ch)
+		tick := time.NewTicker(fd.Interval)
+		defer tick.Stop()
+		last := naming.Signature(instances)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			instances, err := fd.QueryRoute(name)
+			if err != nil {
+				xlog.Error(ctx, "读取注册文件失败", zap.String("path", fd.Path), zap.Error(err))
+				continue
+			}
+			if sig := naming.Signature(instances); sig != last {
+				last = sig
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- instances:
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,25 @@
+package discovery
+
+import (
+	"context"
+	"github.com/YCloud160/microgo/internal/gossip"
+	"github.com/YCloud160/microgo/naming"
+)
+
+// GossipDiscovery returns the instances published by the alive members of
+// the gossip cluster.
+type GossipDiscovery struct {
+	Node *gossip.Node
+}
+
+func NewGossipDiscovery(node *gossip.Node) *GossipDiscovery {
+	return &GossipDiscovery{Node: node}
+}
+
+func (gd *GossipDiscovery) QueryRoute(name string) ([]*naming.Instance, error) {
+	return gd.Node.Instances(name), nil
+}
+
+func (gd *GossipDiscovery) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	return gd.Node.Watch(ctx, name)
+}
@@ -5,21 +5,36 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/YCloud160/microgo/naming"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"time"
 )
 
+const (
+	// watchTimeout is how long the registry holds a watch request without change.
+	watchTimeout      = 30 * time.Second
+	watchRetryBackoff = time.Second
+	watchMaxBackoff   = 30 * time.Second
+)
+
+// ErrNotFoundPath is returned when the registry does not serve the endpoint,
+// e.g. a registry without watch support.
+var ErrNotFoundPath = fmt.Errorf("registry path not found")
+
 type RouteResp struct {
-	Code   int32    `json:"code"`
-	Msg    string   `json:"msg"`
-	Routes []*Route `json:"routes"`
+	Code     int32              `json:"code"`
+	Msg      string             `json:"msg"`
+	Revision int64              `json:"revision"`
+	Routes   []*naming.Instance `json:"routes"`
 }
 
-type Route struct {
-	Addr string `json:"addr"`
-	Name string `json:"name"`
+type watchReq struct {
+	Name     string `json:"name"`
+	Revision int64  `json:"revision"`
+	Timeout  int64  `json:"timeout"`
 }
 
 type MicroDiscovery struct {
@@ -30,10 +45,68 @@ func NewMicroDiscovery(host string) *MicroDiscovery {
 	return &MicroDiscovery{Host: host}
 }
 
-func (md *MicroDiscovery) QueryRoute(name string) ([]string, error) {
+func (md *MicroDiscovery) QueryRoute(name string) ([]*naming.Instance, error) {
 	url := fmt.Sprintf("http://%s/micro/route/query", md.Host)
-	bs, _ := json.Marshal(map[string]string{"name": name})
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bs))
+	res, err := md.request(context.TODO(), url, map[string]string{"name": name})
+	if err != nil {
+		return nil, err
+	}
+	return res.Routes, nil
+}
+
+// Watch long-polls the registry with the last revision seen, the registry
+// answers as soon as the routes of the service change. The channel is closed
+// when ctx is done, or at once when the registry does not support watching.
+func (md *MicroDiscovery) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	url := fmt.Sprintf("http://%s/micro/route/watch", md.Host)
+	res, err := md.request(ctx, url, &watchReq{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []*naming.Instance, 1)
+	ch <- res.Routes
+	go func() {
+		defer close(ch)
+		revision := res.Revision
+		backoff := watchRetryBackoff
+		for {
+			res, err := md.request(ctx, url, &watchReq{Name: name, Revision: revision, Timeout: watchTimeout.Milliseconds()})
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if err == ErrNotFoundPath {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if backoff *= 2; backoff > watchMaxBackoff {
+					backoff = watchMaxBackoff
+				}
+				continue
+			}
+			backoff = watchRetryBackoff
+			if res.Revision == revision {
+				continue
+			}
+			revision = res.Revision
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- res.Routes:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (md *MicroDiscovery) request(ctx context.Context, url string, data any) (*RouteResp, error) {
+	bs, _ := json.Marshal(data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(bs))
 	if err != nil {
 		xlog.Error(context.TODO(), "请求失败", zap.String("url", url), zap.Error(err))
 		return nil, err
@@ -41,9 +114,15 @@ func (md *MicroDiscovery) QueryRoute(name string) ([]string, error) {
 	req.Header.Set("content-type", "application/json;charset=utf-8")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		xlog.Error(context.TODO(), "请求失败", zap.String("url", url), zap.Error(err))
+		if ctx.Err() == nil {
+			xlog.Error(context.TODO(), "请求失败", zap.String("url", url), zap.Error(err))
+		}
 		return nil, err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFoundPath
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		xlog.Error(context.TODO(), "解析数据失败", zap.String("url", url), zap.Error(err))
@@ -58,9 +137,5 @@ func (md *MicroDiscovery) QueryRoute(name string) ([]string, error) {
 		xlog.Error(context.TODO(), "获取数据失败", zap.String("res", string(body)))
 		return nil, fmt.Errorf("%s", res.Msg)
 	}
-	routes := make([]string, 0, len(res.Routes))
-	for _, r := range res.Routes {
-		routes = append(routes, r.Addr)
-	}
-	return routes, nil
+	return res, nil
 }
@@ -0,0 +1,355 @@
+// Package dns resolves the instances of a service from the A/AAAA or SRV
+// records of a DNS server, for the dns discovery.
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/YCloud160/microgo/naming"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ModeA   = "a"
+	ModeSRV = "srv"
+
+	// NamePlaceholder is replaced by the name of the service in Client.Domain.
+	NamePlaceholder = "{name}"
+
+	watchRetryBackoff = time.Second
+	watchMaxBackoff   = 30 * time.Second
+)
+
+// Client resolves the services on Server. Domain is the template of the
+// name queried for a service, Port the port of the instances in ModeA. The
+// answers are cached for their ttl kept between MinTTL and MaxTTL.
+type Client struct {
+	Server  string
+	Timeout time.Duration
+	Mode    string
+	Domain  string
+	Port    int
+	MinTTL  time.Duration
+	MaxTTL  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	instances []*naming.Instance
+	expireAt  time.Time
+}
+
+func (c *Client) QueryRoute(name string) ([]*naming.Instance, error) {
+	c.mu.Lock()
+	entry, ok := c.cache[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expireAt) {
+		return entry.instances, nil
+	}
+	instances, _, err := c.resolve(context.TODO(), name)
+	return instances, err
+}
+
+// Watch resolves the service again whenever the ttl of the last answer
+// passes and pushes the instances when they change. The channel is closed
+// when ctx is done.
+func (c *Client) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	instances, ttl, err := c.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []*naming.Instance, 1)
+	ch <- instances
+	go func() {
+		defer close(ch)
+		last := naming.Signature(instances)
+		backoff := watchRetryBackoff
+		wait := ttl
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			instances, ttl, err := c.resolve(ctx, name)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				wait = backoff
+				if backoff *= 2; backoff > watchMaxBackoff {
+					backoff = watchMaxBackoff
+				}
+				continue
+			}
+			backoff = watchRetryBackoff
+			wait = ttl
+			sig := naming.Signature(instances)
+			if sig == last {
+				continue
+			}
+			last = sig
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- instances:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// resolve looks the service up and caches the answer for its ttl.
+func (c *Client) resolve(ctx context.Context, name string) ([]*naming.Instance, time.Duration, error) {
+	domain := strings.ReplaceAll(c.Domain, NamePlaceholder, name)
+	if len(domain) == 0 {
+		domain = name
+	}
+	var (
+		instances []*naming.Instance
+		ttl       uint32
+		err       error
+	)
+	if c.Mode == ModeSRV {
+		instances, ttl, err = c.lookupSRV(ctx, name, domain)
+	} else {
+		instances, ttl, err = c.lookupA(ctx, name, domain)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d := time.Duration(ttl) * time.Second
+	if d < c.MinTTL {
+		d = c.MinTTL
+	}
+	if c.MaxTTL > 0 && d > c.MaxTTL {
+		d = c.MaxTTL
+	}
+	c.mu.Lock()
+	if c.cache == nil {
+		c.cache = make(map[string]*cacheEntry)
+	}
+	c.cache[name] = &cacheEntry{instances: instances, expireAt: time.Now().Add(d)}
+	c.mu.Unlock()
+	return instances, d, nil
+}
+
+func (c *Client) lookupA(ctx context.Context, name, domain string) ([]*naming.Instance, uint32, error) {
+	ips, ttl, err := c.lookupIP(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := make([]*naming.Instance, 0, len(ips))
+	for _, ip := range ips {
+		instances = append(instances, &naming.Instance{
+			Name:   name,
+			Addr:   net.JoinHostPort(ip.String(), strconv.Itoa(c.Port)),
+			Weight: naming.DefaultWeight,
+		})
+	}
+	return instances, ttl, nil
+}
+
+// lookupSRV returns an instance for each address of the targets of the SRV
+// records with the lowest priority. The addresses in the additional section
+// of the answer are used instead of querying the targets when present.
+func (c *Client) lookupSRV(ctx context.Context, name, domain string) ([]*naming.Instance, uint32, error) {
+	msg, err := c.Exchange(ctx, domain, TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl := uint32(0)
+	var records []*Record
+	for _, rr := range msg.Answers {
+		if rr.SRV == nil {
+			continue
+		}
+		if len(records) > 0 && rr.SRV.Priority > records[0].SRV.Priority {
+			continue
+		}
+		if len(records) > 0 && rr.SRV.Priority < records[0].SRV.Priority {
+			records = records[:0]
+		}
+		records = append(records, rr)
+		ttl = minTTL(ttl, rr.TTL)
+	}
+
+	additions := make(map[string][]*Record)
+	for _, rr := range msg.Additions {
+		if rr.IP != nil {
+			key := strings.ToLower(rr.Name)
+			additions[key] = append(additions[key], rr)
+		}
+	}
+
+	var instances []*naming.Instance
+	for _, rr := range records {
+		var ips []net.IP
+		if rrs, ok := additions[strings.ToLower(rr.SRV.Target)]; ok {
+			for _, a := range rrs {
+				ips = append(ips, a.IP)
+				ttl = minTTL(ttl, a.TTL)
+			}
+		} else {
+			var ipTTL uint32
+			if ips, ipTTL, err = c.lookupIP(ctx, rr.SRV.Target); err != nil {
+				return nil, 0, err
+			}
+			ttl = minTTL(ttl, ipTTL)
+		}
+		weight := int(rr.SRV.Weight)
+		if weight == 0 {
+			weight = naming.DefaultWeight
+		}
+		for _, ip := range ips {
+			instances = append(instances, &naming.Instance{
+				Name:   name,
+				Addr:   net.JoinHostPort(ip.String(), strconv.Itoa(int(rr.SRV.Port))),
+				Weight: weight,
+			})
+		}
+	}
+	return instances, ttl, nil
+}
+
+// lookupIP returns the addresses of the A and AAAA records of domain.
+func (c *Client) lookupIP(ctx context.Context, domain string) ([]net.IP, uint32, error) {
+	var (
+		ips []net.IP
+		ttl uint32
+	)
+	for _, qtype := range []uint16{TypeA, TypeAAAA} {
+		msg, err := c.Exchange(ctx, domain, qtype)
+		if err != nil && qtype == TypeAAAA {
+			// a resolver failing the AAAA queries leaves the A records
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, rr := range msg.Answers {
+			if rr.Type == qtype && rr.IP != nil {
+				ips = append(ips, rr.IP)
+				ttl = minTTL(ttl, rr.TTL)
+			}
+		}
+	}
+	return ips, ttl, nil
+}
+
+// Exchange sends the query to the server over UDP, and again over TCP when
+// the answer is truncated. A name that does not exist has no answer.
+func (c *Client) Exchange(ctx context.Context, domain string, qtype uint16) (*Message, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	query := newQuery(uint16(rand.Uint32()), domain, qtype)
+	bs, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.exchange(ctx, "udp", query, bs)
+	if err == nil && msg.Truncated() {
+		msg, err = c.exchange(ctx, "tcp", query, bs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch msg.RCode() {
+	case 0:
+	case rcodeNameError:
+		msg.Answers, msg.Additions = nil, nil
+	default:
+		return nil, fmt.Errorf("dns: query %s failed with rcode %d", domain, msg.RCode())
+	}
+	return msg, nil
+}
+
+func (c *Client) exchange(ctx context.Context, network string, query *Message, bs []byte) (*Message, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, c.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		bs = append(binary.BigEndian.AppendUint16(nil, uint16(len(bs))), bs...)
+	}
+	if _, err := conn.Write(bs); err != nil {
+		return nil, err
+	}
+
+	for {
+		var resp []byte
+		if network == "tcp" {
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return nil, err
+			}
+			resp = make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, resp); err != nil {
+				return nil, err
+			}
+		} else {
+			resp = make([]byte, 65535)
+			n, err := conn.Read(resp)
+			if err != nil {
+				return nil, err
+			}
+			resp = resp[:n]
+		}
+		msg, err := Unpack(resp)
+		if err != nil {
+			return nil, err
+		}
+		// skip the stray answers of former queries
+		if msg.ID != query.ID || msg.Flags&flagResponse == 0 || !strings.EqualFold(msg.Name, strings.TrimSuffix(query.Name, ".")) {
+			if network == "tcp" {
+				return nil, errors.New("dns: unexpected answer")
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+func minTTL(ttl, v uint32) uint32 {
+	if ttl == 0 || v < ttl {
+		return v
+	}
+	return ttl
+}
+
+// DefaultServer returns the first name server of /etc/resolv.conf, or the
+// local one when there is none.
+func DefaultServer() string {
+	bs, err := os.ReadFile("/etc/resolv.conf")
+	if err == nil {
+		for _, line := range strings.Split(string(bs), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
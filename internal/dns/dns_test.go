@@ -0,0 +1,171 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+// fakeServer answers the queries over UDP from its records, the names
+// without record do not exist.
+type fakeServer struct {
+	mu      sync.Mutex
+	records map[string][]*Record
+	queries int
+	// drop is the type of the queries left unanswered.
+	drop uint16
+	conn net.PacketConn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{records: make(map[string][]*Record), conn: conn}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) set(name string, records ...*Record) {
+	s.mu.Lock()
+	s.records[name] = records
+	s.mu.Unlock()
+}
+
+func (s *fakeServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query, err := Unpack(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		s.queries++
+		if query.Type == s.drop {
+			s.mu.Unlock()
+			continue
+		}
+		records, ok := s.records[query.Name]
+		resp := &Message{ID: query.ID, Flags: flagResponse, Name: query.Name, Type: query.Type}
+		if !ok {
+			resp.Flags |= rcodeNameError
+		}
+		for _, rr := range records {
+			switch {
+			case rr.Type == query.Type:
+				resp.Answers = append(resp.Answers, rr)
+			case query.Type == TypeSRV:
+				resp.Additions = append(resp.Additions, rr)
+			}
+		}
+		s.mu.Unlock()
+		bs, _ := resp.Pack()
+		s.conn.WriteTo(bs, addr)
+	}
+}
+
+func addrs(instances []*naming.Instance) []string {
+	hosts := naming.Addrs(instances)
+	sort.Strings(hosts)
+	return hosts
+}
+
+func TestLookupA(t *testing.T) {
+	s := newFakeServer(t)
+	s.set("demo.svc.local",
+		&Record{Name: "demo.svc.local", Type: TypeA, TTL: 1, IP: net.ParseIP("10.0.0.1")},
+		&Record{Name: "demo.svc.local", Type: TypeAAAA, TTL: 5, IP: net.ParseIP("fd00::1")},
+	)
+	client := &Client{Server: s.conn.LocalAddr().String(), Timeout: time.Second, Mode: ModeA, Domain: "{name}.svc.local", Port: 8080, MinTTL: 100 * time.Millisecond}
+
+	instances, err := client.QueryRoute("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := addrs(instances); len(hosts) != 2 || hosts[0] != "10.0.0.1:8080" || hosts[1] != "[fd00::1]:8080" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	// answered from the cache until the ttl passes
+	client.QueryRoute("demo")
+	s.mu.Lock()
+	queries := s.queries
+	s.mu.Unlock()
+	if queries != 2 {
+		t.Fatalf("expect 2 queries, got %d", queries)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := client.Watch(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	s.set("demo.svc.local", &Record{Name: "demo.svc.local", Type: TypeA, TTL: 1, IP: net.ParseIP("10.0.0.2")})
+	select {
+	case instances := <-ch:
+		if hosts := addrs(instances); len(hosts) != 1 || hosts[0] != "10.0.0.2:8080" {
+			t.Fatalf("unexpected hosts %v", hosts)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch got no update")
+	}
+}
+
+func TestLookupAAAAFailure(t *testing.T) {
+	s := newFakeServer(t)
+	s.mu.Lock()
+	s.drop = TypeAAAA
+	s.mu.Unlock()
+	s.set("demo.svc.local", &Record{Name: "demo.svc.local", Type: TypeA, TTL: 1, IP: net.ParseIP("10.0.0.1")})
+	client := &Client{Server: s.conn.LocalAddr().String(), Timeout: 100 * time.Millisecond, Mode: ModeA, Domain: "{name}.svc.local", Port: 8080, MinTTL: 100 * time.Millisecond}
+
+	instances, err := client.QueryRoute("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := addrs(instances); len(hosts) != 1 || hosts[0] != "10.0.0.1:8080" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+}
+
+func TestLookupSRV(t *testing.T) {
+	s := newFakeServer(t)
+	s.set("_demo._tcp.local",
+		&Record{Name: "_demo._tcp.local", Type: TypeSRV, TTL: 30, SRV: &SRV{Priority: 10, Weight: 20, Port: 9001, Target: "a.local"}},
+		&Record{Name: "_demo._tcp.local", Type: TypeSRV, TTL: 30, SRV: &SRV{Priority: 10, Weight: 0, Port: 9002, Target: "b.local"}},
+		&Record{Name: "_demo._tcp.local", Type: TypeSRV, TTL: 30, SRV: &SRV{Priority: 20, Weight: 10, Port: 9003, Target: "c.local"}},
+		&Record{Name: "a.local", Type: TypeA, TTL: 30, IP: net.ParseIP("10.0.0.1")},
+	)
+	s.set("b.local", &Record{Name: "b.local", Type: TypeA, TTL: 30, IP: net.ParseIP("10.0.0.2")})
+	client := &Client{Server: s.conn.LocalAddr().String(), Timeout: time.Second, Mode: ModeSRV, Domain: "_{name}._tcp.local", MinTTL: time.Second}
+
+	instances, err := client.QueryRoute("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := addrs(instances); len(hosts) != 2 || hosts[0] != "10.0.0.1:9001" || hosts[1] != "10.0.0.2:9002" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	for _, ins := range instances {
+		if ins.Addr == "10.0.0.1:9001" && ins.Weight != 20 || ins.Addr == "10.0.0.2:9002" && ins.Weight != naming.DefaultWeight {
+			t.Fatalf("unexpected weight %+v", ins)
+		}
+	}
+
+	instances, err = client.QueryRoute("unknown")
+	if err != nil || len(instances) != 0 {
+		t.Fatalf("expect no instance, got %v %v", instances, err)
+	}
+}
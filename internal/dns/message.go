@@ -0,0 +1,273 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	TypeA    uint16 = 1
+	TypeAAAA uint16 = 28
+	TypeSRV  uint16 = 33
+
+	classINET uint16 = 1
+
+	headerLen = 12
+
+	flagResponse  = 1 << 15
+	flagTruncated = 1 << 9
+	flagRecursion = 1 << 8
+
+	rcodeNameError = 3
+)
+
+var errMalformed = errors.New("dns: malformed message")
+
+// SRV is the data of a SRV record.
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// Record is a resource record of an answer, IP is set for A and AAAA
+// records and SRV for SRV records.
+type Record struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	IP   net.IP
+	SRV  *SRV
+}
+
+// Message is the part of a DNS message used by the discovery.
+type Message struct {
+	ID        uint16
+	Flags     uint16
+	Name      string
+	Type      uint16
+	Answers   []*Record
+	Additions []*Record
+}
+
+func (m *Message) RCode() int {
+	return int(m.Flags & 0xf)
+}
+
+func (m *Message) Truncated() bool {
+	return m.Flags&flagTruncated != 0
+}
+
+// newQuery returns a recursive query of the records of type qtype of name.
+func newQuery(id uint16, name string, qtype uint16) *Message {
+	return &Message{ID: id, Flags: flagRecursion, Name: name, Type: qtype}
+}
+
+// Pack encodes the message, the records are packed without name compression.
+func (m *Message) Pack() ([]byte, error) {
+	bs := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(bs[0:], m.ID)
+	binary.BigEndian.PutUint16(bs[2:], m.Flags)
+	binary.BigEndian.PutUint16(bs[4:], 1)
+	binary.BigEndian.PutUint16(bs[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(bs[10:], uint16(len(m.Additions)))
+
+	bs, err := appendName(bs, m.Name)
+	if err != nil {
+		return nil, err
+	}
+	bs = binary.BigEndian.AppendUint16(bs, m.Type)
+	bs = binary.BigEndian.AppendUint16(bs, classINET)
+	for _, rr := range append(m.Answers, m.Additions...) {
+		if bs, err = appendRecord(bs, rr); err != nil {
+			return nil, err
+		}
+	}
+	return bs, nil
+}
+
+func appendRecord(bs []byte, rr *Record) ([]byte, error) {
+	bs, err := appendName(bs, rr.Name)
+	if err != nil {
+		return nil, err
+	}
+	bs = binary.BigEndian.AppendUint16(bs, rr.Type)
+	bs = binary.BigEndian.AppendUint16(bs, classINET)
+	bs = binary.BigEndian.AppendUint32(bs, rr.TTL)
+
+	var data []byte
+	switch rr.Type {
+	case TypeA:
+		data = rr.IP.To4()
+	case TypeAAAA:
+		data = rr.IP.To16()
+	case TypeSRV:
+		data = binary.BigEndian.AppendUint16(data, rr.SRV.Priority)
+		data = binary.BigEndian.AppendUint16(data, rr.SRV.Weight)
+		data = binary.BigEndian.AppendUint16(data, rr.SRV.Port)
+		if data, err = appendName(data, rr.SRV.Target); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("dns: unsupported record type %d", rr.Type)
+	}
+	bs = binary.BigEndian.AppendUint16(bs, uint16(len(data)))
+	return append(bs, data...), nil
+}
+
+func appendName(bs []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 0 {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 63 {
+				return nil, fmt.Errorf("dns: invalid name %q", name)
+			}
+			bs = append(bs, byte(len(label)))
+			bs = append(bs, label...)
+		}
+	}
+	return append(bs, 0), nil
+}
+
+// Unpack decodes a message, the records of unsupported types are skipped.
+func Unpack(bs []byte) (*Message, error) {
+	if len(bs) < headerLen {
+		return nil, errMalformed
+	}
+	m := &Message{
+		ID:    binary.BigEndian.Uint16(bs[0:]),
+		Flags: binary.BigEndian.Uint16(bs[2:]),
+	}
+	qdCount := int(binary.BigEndian.Uint16(bs[4:]))
+	anCount := int(binary.BigEndian.Uint16(bs[6:]))
+	nsCount := int(binary.BigEndian.Uint16(bs[8:]))
+	arCount := int(binary.BigEndian.Uint16(bs[10:]))
+
+	off := headerLen
+	for i := 0; i < qdCount; i++ {
+		name, n, err := readName(bs, off)
+		if err != nil {
+			return nil, err
+		}
+		if n+4 > len(bs) {
+			return nil, errMalformed
+		}
+		if i == 0 {
+			m.Name = name
+			m.Type = binary.BigEndian.Uint16(bs[n:])
+		}
+		off = n + 4
+	}
+	for i := 0; i < anCount+nsCount+arCount; i++ {
+		rr, n, err := readRecord(bs, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if rr == nil {
+			continue
+		}
+		switch {
+		case i < anCount:
+			m.Answers = append(m.Answers, rr)
+		case i >= anCount+nsCount:
+			m.Additions = append(m.Additions, rr)
+		}
+	}
+	return m, nil
+}
+
+func readRecord(bs []byte, off int) (*Record, int, error) {
+	name, off, err := readName(bs, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	if off+10 > len(bs) {
+		return nil, 0, errMalformed
+	}
+	rr := &Record{
+		Name: name,
+		Type: binary.BigEndian.Uint16(bs[off:]),
+		TTL:  binary.BigEndian.Uint32(bs[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(bs[off+8:]))
+	off += 10
+	end := off + length
+	if end > len(bs) {
+		return nil, 0, errMalformed
+	}
+	switch rr.Type {
+	case TypeA:
+		if length != net.IPv4len {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), bs[off:end]...))
+	case TypeAAAA:
+		if length != net.IPv6len {
+			return nil, 0, errMalformed
+		}
+		rr.IP = net.IP(append([]byte(nil), bs[off:end]...))
+	case TypeSRV:
+		if length < 7 {
+			return nil, 0, errMalformed
+		}
+		target, _, err := readName(bs, off+6)
+		if err != nil {
+			return nil, 0, err
+		}
+		rr.SRV = &SRV{
+			Priority: binary.BigEndian.Uint16(bs[off:]),
+			Weight:   binary.BigEndian.Uint16(bs[off+2:]),
+			Port:     binary.BigEndian.Uint16(bs[off+4:]),
+			Target:   target,
+		}
+	default:
+		return nil, end, nil
+	}
+	return rr, end, nil
+}
+
+// readName reads the possibly compressed name at off, it returns the offset
+// following the name in the message.
+func readName(bs []byte, off int) (string, int, error) {
+	var (
+		labels []string
+		next   = -1
+		jumps  int
+	)
+	for {
+		if off >= len(bs) {
+			return "", 0, errMalformed
+		}
+		length := int(bs[off])
+		switch {
+		case length == 0:
+			off++
+			if next < 0 {
+				next = off
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(bs) {
+				return "", 0, errMalformed
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(bs[off:]) & 0x3fff)
+		default:
+			if off+1+length > len(bs) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(bs[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package filestore keeps the instances of the file registry in a JSON file
+// shared by every process of the host.
+package filestore
+
+import (
+	"encoding/json"
+	"github.com/YCloud160/microgo/naming"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Record struct {
+	naming.Instance
+	// ExpireAt is the unix time in milliseconds after which the instance is
+	// considered gone unless it is kept alive.
+	ExpireAt int64 `json:"expireAt"`
+}
+
+func (r *Record) Expired(now time.Time) bool {
+	return r.ExpireAt <= now.UnixMilli()
+}
+
+type file struct {
+	Records []*Record `json:"instances"`
+}
+
+// Load reads the records of the file, a missing file has no record.
+func Load(path string) ([]*Record, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(bs) == 0 {
+		return nil, nil
+	}
+	f := &file{}
+	if err := json.Unmarshal(bs, f); err != nil {
+		return nil, err
+	}
+	return f.Records, nil
+}
+
+// Alive returns the instances of the service whose records are not expired.
+func Alive(path, name string) ([]*naming.Instance, error) {
+	records, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	instances := make([]*naming.Instance, 0, len(records))
+	for _, r := range records {
+		if r.Name == name && !r.Expired(now) {
+			ins := r.Instance
+			instances = append(instances, &ins)
+		}
+	}
+	return instances, nil
+}
+
+// Update rewrites the file with the records returned by fn while holding the
+// file lock, the expired records are dropped. The file is replaced atomically
+// so that readers never need the lock.
+func Update(path string, fn func(records []*Record) ([]*Record, error)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := Load(path)
+	if err != nil {
+		return err
+	}
+	records, err = fn(records)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	f := &file{Records: make([]*Record, 0, len(records))}
+	for _, r := range records {
+		if !r.Expired(now) {
+			f.Records = append(f.Records, r)
+		}
+	}
+	bs, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
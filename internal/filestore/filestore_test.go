@@ -0,0 +1,58 @@
+package filestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+func TestConcurrentUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Update(path, func(records []*Record) ([]*Record, error) {
+				return append(records, &Record{
+					Instance: naming.Instance{Name: "demo", Addr: fmt.Sprintf("127.0.0.1:%d", 8000+i)},
+					ExpireAt: time.Now().Add(time.Minute).UnixMilli(),
+				}), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	instances, err := Alive(path, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 20 {
+		t.Fatalf("expect 20 instances, got %d", len(instances))
+	}
+}
+
+func TestExpiredRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	err := Update(path, func(records []*Record) ([]*Record, error) {
+		return []*Record{
+			{Instance: naming.Instance{Name: "demo", Addr: "a"}, ExpireAt: time.Now().Add(time.Minute).UnixMilli()},
+			{Instance: naming.Instance{Name: "demo", Addr: "b"}, ExpireAt: time.Now().Add(-time.Second).UnixMilli()},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ := Load(path)
+	if len(records) != 1 || records[0].Addr != "a" {
+		t.Fatalf("expired record kept: %v", records)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !unix
+
+package filestore
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	lockRetryTimes    = 100
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// lock creates the lock file exclusively, a lock file left by a crashed
+// process older than lockRetryTimes*lockRetryInterval is taken over.
+func lock(path string) (func(), error) {
+	for i := 0; ; i++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if i >= lockRetryTimes {
+			os.Remove(path)
+			i = 0
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,519 @@
+// Package gossip keeps the membership of a cluster of microgo processes with
+// a SWIM-style failure detector over UDP. Every message carries the members
+// known by its sender, with the instances they publish, so the membership
+// spreads without a registry.
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/YCloud160/microgo/naming"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+const (
+	msgPing    = "ping"
+	msgAck     = "ack"
+	msgPingReq = "ping-req"
+
+	maxPacketSize = 65507
+
+	// readBackoff and maxReadBackoff bound the wait after a failed read.
+	readBackoff    = 10 * time.Millisecond
+	maxReadBackoff = time.Second
+
+	// deadRetention is how long a dead member is still gossiped, so that it
+	// refutes its death with a newer incarnation when it comes back.
+	deadRetention = time.Minute
+)
+
+// Member is a process of the cluster identified by its gossip address. The
+// incarnation is only increased by the member itself, to refute a suspicion
+// or to publish new instances. It starts from the clock so that a restarted
+// member is newer than what the others remember of it.
+type Member struct {
+	Addr        string             `json:"addr"`
+	Incarnation uint64             `json:"incarnation"`
+	State       State              `json:"state"`
+	Instances   []*naming.Instance `json:"instances,omitempty"`
+}
+
+type message struct {
+	Type    string    `json:"type"`
+	Seq     uint64    `json:"seq"`
+	Target  string    `json:"target,omitempty"`
+	Members []*Member `json:"members,omitempty"`
+}
+
+type Config struct {
+	// Bind is the UDP address listened to, Advertise the address given to
+	// the other members, the address of the listener by default.
+	Bind      string
+	Advertise string
+	Seeds     []string
+
+	// ProbeInterval is the pace at which a member is probed, ProbeTimeout
+	// how long its ack is waited for before asking IndirectProbes members to
+	// probe it, SuspectTimeout how long it stays suspect before it is dead.
+	ProbeInterval  time.Duration
+	ProbeTimeout   time.Duration
+	SuspectTimeout time.Duration
+	IndirectProbes int
+}
+
+type member struct {
+	Member
+	stateAt time.Time
+}
+
+type Node struct {
+	conf Config
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	self    *Member
+	members map[string]*member
+	seq     uint64
+	acks    map[uint64]func()
+	changed chan struct{}
+	probes  []string
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNode listens on conf.Bind and joins the cluster through the seeds.
+func NewNode(conf Config) (*Node, error) {
+	conn, err := net.ListenPacket("udp", conf.Bind)
+	if err != nil {
+		return nil, err
+	}
+	if len(conf.Advertise) == 0 {
+		conf.Advertise = conn.LocalAddr().String()
+	}
+	n := &Node{
+		conf:    conf,
+		conn:    conn,
+		self:    &Member{Addr: conf.Advertise, Incarnation: uint64(time.Now().UnixNano())},
+		members: make(map[string]*member),
+		acks:    make(map[uint64]func()),
+		changed: make(chan struct{}),
+		stopCh:  make(chan struct{}),
+	}
+	go n.receive()
+	go n.probeLoop()
+	n.joinSeeds()
+	return n, nil
+}
+
+func (n *Node) Addr() string {
+	return n.self.Addr
+}
+
+// Close stops the node, the other members see it dead after the suspect timeout.
+func (n *Node) Close() error {
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+		n.conn.Close()
+	})
+	return nil
+}
+
+// Members returns the known members but the node itself.
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, m.Member)
+	}
+	return members
+}
+
+// AddInstance publishes the instance, replacing the instance with the same
+// name and address.
+func (n *Node) AddInstance(ins *naming.Instance) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.self.Instances = append(removeInstance(n.self.Instances, ins), ins)
+	n.self.Incarnation++
+	n.notify()
+}
+
+func (n *Node) RemoveInstance(ins *naming.Instance) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.self.Instances = removeInstance(n.self.Instances, ins)
+	n.self.Incarnation++
+	n.notify()
+}
+
+func (n *Node) HasInstance(ins *naming.Instance) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, i := range n.self.Instances {
+		if i.Name == ins.Name && i.Addr == ins.Addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Instances returns the instances of the service published by the node and
+// by the alive members.
+func (n *Node) Instances(name string) []*naming.Instance {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var instances []*naming.Instance
+	appendInstances := func(m *Member) {
+		for _, ins := range m.Instances {
+			if ins.Name == name {
+				instances = append(instances, ins)
+			}
+		}
+	}
+	appendInstances(n.self)
+	for _, m := range n.members {
+		if m.State == StateAlive {
+			appendInstances(&m.Member)
+		}
+	}
+	return instances
+}
+
+// Watch pushes the instances of the service whenever they change, the
+// channel is closed when ctx is done or the node closed.
+func (n *Node) Watch(ctx context.Context, name string) (<-chan []*naming.Instance, error) {
+	ch := make(chan []*naming.Instance, 1)
+	n.mu.Lock()
+	changed := n.changed
+	n.mu.Unlock()
+	instances := n.Instances(name)
+	ch <- instances
+	go func() {
+		defer close(ch)
+		last := naming.Signature(instances)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-n.stopCh:
+				return
+			case <-changed:
+			}
+			n.mu.Lock()
+			changed = n.changed
+			n.mu.Unlock()
+			instances := n.Instances(name)
+			sig := naming.Signature(instances)
+			if sig == last {
+				continue
+			}
+			last = sig
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- instances:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// notify wakes the watchers up, n.mu must be held.
+func (n *Node) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *Node) receive() {
+	buf := make([]byte, maxPacketSize)
+	backoff := readBackoff
+	for {
+		size, addr, err := n.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-n.stopCh:
+				timer.Stop()
+				return
+			}
+			if backoff *= 2; backoff > maxReadBackoff {
+				backoff = maxReadBackoff
+			}
+			continue
+		}
+		backoff = readBackoff
+		msg := &message{}
+		if err := json.Unmarshal(buf[:size], msg); err != nil {
+			continue
+		}
+		n.merge(msg.Members)
+
+		switch msg.Type {
+		case msgPing:
+			n.send(addr.String(), &message{Type: msgAck, Seq: msg.Seq})
+		case msgAck:
+			n.mu.Lock()
+			handler, ok := n.acks[msg.Seq]
+			delete(n.acks, msg.Seq)
+			n.mu.Unlock()
+			if ok {
+				handler()
+			}
+		case msgPingReq:
+			from, seq := addr.String(), msg.Seq
+			n.ping(msg.Target, func() {
+				n.send(from, &message{Type: msgAck, Seq: seq})
+			})
+		}
+	}
+}
+
+// merge applies the members gossiped by another node. A newer incarnation
+// wins, and for the same incarnation dead overrides suspect which overrides
+// alive. A suspicion or death of the node itself is refuted.
+func (n *Node) merge(updates []*Member) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	changed := false
+	now := time.Now()
+	for _, u := range updates {
+		if u.Addr == n.self.Addr {
+			// a suspicion, or an incarnation of a previous run, is overtaken
+			if u.Incarnation > n.self.Incarnation || u.State != StateAlive && u.Incarnation == n.self.Incarnation {
+				n.self.Incarnation = u.Incarnation + 1
+			}
+			continue
+		}
+		m, ok := n.members[u.Addr]
+		if !ok {
+			if u.State == StateDead {
+				continue
+			}
+			n.members[u.Addr] = &member{Member: *u, stateAt: now}
+			changed = true
+			continue
+		}
+		if u.Incarnation < m.Incarnation || u.Incarnation == m.Incarnation && u.State <= m.State {
+			continue
+		}
+		if u.Incarnation > m.Incarnation {
+			m.Instances = u.Instances
+		}
+		if u.State != m.State {
+			m.stateAt = now
+		}
+		m.Incarnation, m.State = u.Incarnation, u.State
+		changed = true
+	}
+	if changed {
+		n.notify()
+	}
+}
+
+// snapshot returns the members to gossip, the node itself included.
+func (n *Node) snapshot() []*Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	self := *n.self
+	members := []*Member{&self}
+	for _, m := range n.members {
+		mm := m.Member
+		members = append(members, &mm)
+	}
+	return members
+}
+
+func (n *Node) send(addr string, msg *message) {
+	msg.Members = n.snapshot()
+	bs, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return
+	}
+	n.conn.WriteTo(bs, udpAddr)
+}
+
+// ping sends a ping to addr, onAck is called when it is acknowledged.
+func (n *Node) ping(addr string, onAck func()) uint64 {
+	n.mu.Lock()
+	n.seq++
+	seq := n.seq
+	if onAck != nil {
+		n.acks[seq] = onAck
+	}
+	n.mu.Unlock()
+	if onAck != nil {
+		time.AfterFunc(n.conf.ProbeInterval, func() {
+			n.mu.Lock()
+			delete(n.acks, seq)
+			n.mu.Unlock()
+		})
+	}
+	n.send(addr, &message{Type: msgPing, Seq: seq})
+	return seq
+}
+
+func (n *Node) joinSeeds() {
+	n.mu.Lock()
+	var seeds []string
+	for _, seed := range n.conf.Seeds {
+		if m, ok := n.members[seed]; seed != n.self.Addr && (!ok || m.State != StateAlive) {
+			seeds = append(seeds, seed)
+		}
+	}
+	n.mu.Unlock()
+	for _, seed := range seeds {
+		n.ping(seed, nil)
+	}
+}
+
+func (n *Node) probeLoop() {
+	tick := time.NewTicker(n.conf.ProbeInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-tick.C:
+		}
+		n.joinSeeds()
+		n.expire()
+		if target, ok := n.nextProbe(); ok {
+			go n.probe(target)
+		}
+	}
+}
+
+// probe pings the target directly, then through other members, and suspects
+// it when no ack came back within the probe interval.
+func (n *Node) probe(target string) {
+	acked := make(chan struct{})
+	var once sync.Once
+	onAck := func() { once.Do(func() { close(acked) }) }
+
+	n.ping(target, onAck)
+	select {
+	case <-acked:
+		return
+	case <-n.stopCh:
+		return
+	case <-time.After(n.conf.ProbeTimeout):
+	}
+
+	seq := n.ping(target, onAck)
+	for _, addr := range n.randomMembers(n.conf.IndirectProbes, target) {
+		n.send(addr, &message{Type: msgPingReq, Seq: seq, Target: target})
+	}
+	select {
+	case <-acked:
+		return
+	case <-n.stopCh:
+		return
+	case <-time.After(n.conf.ProbeInterval - n.conf.ProbeTimeout):
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if m, ok := n.members[target]; ok && m.State == StateAlive {
+		m.State, m.stateAt = StateSuspect, time.Now()
+		n.notify()
+	}
+}
+
+// nextProbe returns the next member to probe, the members are probed in a
+// random order renewed after each round.
+func (n *Node) nextProbe() (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for {
+		if len(n.probes) == 0 {
+			for addr, m := range n.members {
+				if m.State != StateDead {
+					n.probes = append(n.probes, addr)
+				}
+			}
+			if len(n.probes) == 0 {
+				return "", false
+			}
+			rand.Shuffle(len(n.probes), func(i, j int) {
+				n.probes[i], n.probes[j] = n.probes[j], n.probes[i]
+			})
+		}
+		addr := n.probes[0]
+		n.probes = n.probes[1:]
+		if m, ok := n.members[addr]; ok && m.State != StateDead {
+			return addr, true
+		}
+	}
+}
+
+func (n *Node) randomMembers(k int, exclude string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var addrs []string
+	for addr, m := range n.members {
+		if addr != exclude && m.State == StateAlive {
+			addrs = append(addrs, addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > k {
+		addrs = addrs[:k]
+	}
+	return addrs
+}
+
+// expire declares dead the members suspect for too long and forgets the
+// members dead for long enough.
+func (n *Node) expire() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := time.Now()
+	changed := false
+	for addr, m := range n.members {
+		switch {
+		case m.State == StateSuspect && now.Sub(m.stateAt) >= n.conf.SuspectTimeout:
+			m.State, m.stateAt = StateDead, now
+			changed = true
+		case m.State == StateDead && now.Sub(m.stateAt) >= deadRetention:
+			delete(n.members, addr)
+		}
+	}
+	if changed {
+		n.notify()
+	}
+}
+
+func removeInstance(instances []*naming.Instance, ins *naming.Instance) []*naming.Instance {
+	newInstances := make([]*naming.Instance, 0, len(instances))
+	for _, i := range instances {
+		if i.Name == ins.Name && i.Addr == ins.Addr {
+			continue
+		}
+		newInstances = append(newInstances, i)
+	}
+	return newInstances
+}
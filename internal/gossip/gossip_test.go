@@ -0,0 +1,110 @@
+package gossip
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+func newTestNode(t *testing.T, seeds ...string) *Node {
+	t.Helper()
+	n, err := NewNode(Config{
+		Bind:           "127.0.0.1:0",
+		Seeds:          seeds,
+		ProbeInterval:  100 * time.Millisecond,
+		ProbeTimeout:   40 * time.Millisecond,
+		SuspectTimeout: 300 * time.Millisecond,
+		IndirectProbes: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func waitInstances(t *testing.T, n *Node, name string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(n.Instances(name)) == count {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s: expect %d instances, got %v", n.Addr(), count, naming.Addrs(n.Instances(name)))
+}
+
+func TestMembership(t *testing.T) {
+	seed := newTestNode(t)
+	nodes := []*Node{seed}
+	for i := 0; i < 3; i++ {
+		nodes = append(nodes, newTestNode(t, seed.Addr()))
+	}
+	for i, n := range nodes {
+		n.AddInstance(&naming.Instance{Name: "demo", Addr: fmt.Sprintf("127.0.0.1:%d", 8000+i)})
+	}
+	for _, n := range nodes {
+		waitInstances(t, n, "demo", 4)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := seed.Watch(ctx, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+
+	// a failed member is detected and its instances dropped
+	nodes[3].Close()
+	for _, n := range nodes[:3] {
+		waitInstances(t, n, "demo", 3)
+	}
+	select {
+	case instances := <-ch:
+		if len(instances) != 3 {
+			t.Fatalf("expect 3 instances, got %v", naming.Addrs(instances))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watch got no update")
+	}
+
+	// an unregistered instance is dropped without failure detection
+	nodes[1].RemoveInstance(&naming.Instance{Name: "demo", Addr: "127.0.0.1:8001"})
+	for _, n := range nodes[:3] {
+		waitInstances(t, n, "demo", 2)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	seed := newTestNode(t)
+	n := newTestNode(t, seed.Addr())
+	n.AddInstance(&naming.Instance{Name: "demo", Addr: "127.0.0.1:8000"})
+	n.AddInstance(&naming.Instance{Name: "demo", Addr: "127.0.0.1:8001"})
+	waitInstances(t, seed, "demo", 2)
+
+	// the restarted node publishes fewer instances after fewer changes
+	addr := n.Addr()
+	n.Close()
+	restarted, err := NewNode(Config{
+		Bind:           addr,
+		Seeds:          []string{seed.Addr()},
+		ProbeInterval:  100 * time.Millisecond,
+		ProbeTimeout:   40 * time.Millisecond,
+		SuspectTimeout: 300 * time.Millisecond,
+		IndirectProbes: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	restarted.AddInstance(&naming.Instance{Name: "demo", Addr: "127.0.0.1:9000"})
+	waitInstances(t, seed, "demo", 1)
+	if got := seed.Instances("demo")[0].Addr; got != "127.0.0.1:9000" {
+		t.Fatalf("expect the instance of the restarted node, got %s", got)
+	}
+}
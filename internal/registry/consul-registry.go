@@ -0,0 +1,15 @@
+package registry
+
+import (
+	"github.com/YCloud160/microgo/internal/consul"
+)
+
+// ConsulRegistry registers the instances on a Consul agent with a TTL check
+// passed by every keepalive.
+type ConsulRegistry struct {
+	*consul.Client
+}
+
+func NewConsulRegistry(client *consul.Client) *ConsulRegistry {
+	return &ConsulRegistry{Client: client}
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"github.com/YCloud160/microgo/internal/filestore"
+	"github.com/YCloud160/microgo/naming"
+	"time"
+)
+
+// FileRegistry stores the instances in a file shared by the processes of the
+// host, an instance expires when it is not kept alive within TTL.
+type FileRegistry struct {
+	Path string
+	TTL  time.Duration
+}
+
+func NewFileRegistry(path string, ttl time.Duration) *FileRegistry {
+	return &FileRegistry{Path: path, TTL: ttl}
+}
+
+func (fr *FileRegistry) Register(ins *naming.Instance) error {
+	return filestore.Update(fr.Path, func(records []*filestore.Record) ([]*filestore.Record, error) {
+		records = removeRecord(records, ins)
+		return append(records, &filestore.Record{
+			Instance: *ins,
+			ExpireAt: time.Now().Add(fr.TTL).UnixMilli(),
+		}), nil
+	})
+}
+
+func (fr *FileRegistry) UnRegister(ins *naming.Instance) error {
+	return filestore.Update(fr.Path, func(records []*filestore.Record) ([]*filestore.Record, error) {
+		return removeRecord(records, ins), nil
+	})
+}
+
+func (fr *FileRegistry) KeepAlive(ins *naming.Instance) error {
+	return filestore.Update(fr.Path, func(records []*filestore.Record) ([]*filestore.Record, error) {
+		now := time.Now()
+		for _, r := range records {
+			if r.Name == ins.Name && r.Addr == ins.Addr && !r.Expired(now) {
+				r.ExpireAt = now.Add(fr.TTL).UnixMilli()
+				return records, nil
+			}
+		}
+		return nil, naming.ErrUnknownInstance
+	})
+}
+
+func removeRecord(records []*filestore.Record, ins *naming.Instance) []*filestore.Record {
+	newRecords := make([]*filestore.Record, 0, len(records))
+	for _, r := range records {
+		if r.Name == ins.Name && r.Addr == ins.Addr {
+			continue
+		}
+		newRecords = append(newRecords, r)
+	}
+	return newRecords
+}
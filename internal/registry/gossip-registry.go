@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"github.com/YCloud160/microgo/internal/gossip"
+	"github.com/YCloud160/microgo/naming"
+)
+
+// GossipRegistry publishes the instances through the gossip of the node, the
+// instances of a process are dropped by the others when it fails.
+type GossipRegistry struct {
+	Node *gossip.Node
+}
+
+func NewGossipRegistry(node *gossip.Node) *GossipRegistry {
+	return &GossipRegistry{Node: node}
+}
+
+func (gr *GossipRegistry) Register(ins *naming.Instance) error {
+	gr.Node.AddInstance(ins)
+	return nil
+}
+
+func (gr *GossipRegistry) UnRegister(ins *naming.Instance) error {
+	gr.Node.RemoveInstance(ins)
+	return nil
+}
+
+func (gr *GossipRegistry) KeepAlive(ins *naming.Instance) error {
+	if !gr.Node.HasInstance(ins) {
+		return naming.ErrUnknownInstance
+	}
+	return nil
+}
@@ -5,22 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/YCloud160/microgo/naming"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
 )
 
+// codeNotFound is answered to a keepalive of an instance the registry does not know.
+const codeNotFound = 404
+
 type RouteResp struct {
 	Code int32  `json:"code"`
 	Msg  string `json:"msg"`
 }
 
-type Route struct {
-	Addr string `json:"addr"`
-	Name string `json:"name"`
-}
-
 type MicroRegistry struct {
 	Host string
 }
@@ -29,37 +28,25 @@ func NewMicroRegistry(host string) *MicroRegistry {
 	return &MicroRegistry{Host: host}
 }
 
-func (mr *MicroRegistry) Register(name string, addr string) error {
-	data := map[string]string{
-		"name": name,
-		"addr": addr,
-	}
+func (mr *MicroRegistry) Register(ins *naming.Instance) error {
 	url := fmt.Sprintf("http://%s/micro/route/register", mr.Host)
-	_, err := mr.request(url, data)
+	_, err := mr.request(url, ins)
 	return err
 }
 
-func (mr *MicroRegistry) UnRegister(name string, addr string) error {
-	data := map[string]string{
-		"name": name,
-		"addr": addr,
-	}
+func (mr *MicroRegistry) UnRegister(ins *naming.Instance) error {
 	url := fmt.Sprintf("http://%s/micro/route/unregister", mr.Host)
-	_, err := mr.request(url, data)
+	_, err := mr.request(url, ins)
 	return err
 }
 
-func (mr *MicroRegistry) KeepAlive(name string, addr string) error {
-	data := map[string]string{
-		"name": name,
-		"addr": addr,
-	}
+func (mr *MicroRegistry) KeepAlive(ins *naming.Instance) error {
 	url := fmt.Sprintf("http://%s/micro/route/keepalive", mr.Host)
-	_, err := mr.request(url, data)
+	_, err := mr.request(url, ins)
 	return err
 }
 
-func (mr *MicroRegistry) request(url string, data map[string]string) (*RouteResp, error) {
+func (mr *MicroRegistry) request(url string, data any) (*RouteResp, error) {
 	bs, _ := json.Marshal(data)
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bs))
 	if err != nil {
@@ -72,6 +59,7 @@ func (mr *MicroRegistry) request(url string, data map[string]string) (*RouteResp
 		xlog.Error(context.TODO(), "请求失败", zap.String("url", url), zap.Error(err))
 		return nil, err
 	}
+	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		xlog.Error(context.TODO(), "解析数据失败", zap.String("url", url), zap.Error(err))
@@ -82,6 +70,9 @@ func (mr *MicroRegistry) request(url string, data map[string]string) (*RouteResp
 		xlog.Error(context.TODO(), "解析数据失败", zap.String("res", string(body)), zap.Error(err))
 		return nil, err
 	}
+	if res.Code == codeNotFound {
+		return nil, naming.ErrUnknownInstance
+	}
 	if res.Code != 200 {
 		xlog.Error(context.TODO(), "获取数据失败", zap.String("res", string(body)))
 		return nil, fmt.Errorf("%s", res.Msg)
@@ -1,29 +1,81 @@
 package meta
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
+// metaRequestKey holds the metadata of the request being served.
 type metaRequestKey struct{}
 
+// metaKey holds the metadata sent with the outgoing calls.
 type metaKey struct{}
 
+// The maps stored in a context are never modified, every change makes a
+// new copy so that concurrent calls sharing a context cannot race.
+
+// NewIncomingContext returns a context carrying the metadata of the request being served.
+func NewIncomingContext(ctx context.Context, meta map[string]string) context.Context {
+	return context.WithValue(ctx, metaRequestKey{}, copyMeta(meta, 0))
+}
+
+// FromIncomingContext returns a copy of the metadata of the request being served.
+func FromIncomingContext(ctx context.Context) (map[string]string, bool) {
+	meta, ok := ctx.Value(metaRequestKey{}).(map[string]string)
+	return copyMeta(meta, 0), ok
+}
+
+// ValueFromIncomingContext returns one value of the metadata of the request being served.
+func ValueFromIncomingContext(ctx context.Context, key string) string {
+	meta, _ := ctx.Value(metaRequestKey{}).(map[string]string)
+	return meta[key]
+}
+
+// NewOutgoingContext returns a context whose outgoing calls send the metadata,
+// it replaces any metadata already attached.
+func NewOutgoingContext(ctx context.Context, meta map[string]string) context.Context {
+	return context.WithValue(ctx, metaKey{}, copyMeta(meta, 0))
+}
+
+// AppendToOutgoingContext returns a context whose outgoing calls send the
+// metadata already attached plus the given key value pairs.
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	if len(kv)%2 == 1 {
+		panic(fmt.Sprintf("meta: AppendToOutgoingContext got an odd number of input pairs: %d", len(kv)))
+	}
+	old, _ := ctx.Value(metaKey{}).(map[string]string)
+	meta := copyMeta(old, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		meta[kv[i]] = kv[i+1]
+	}
+	return context.WithValue(ctx, metaKey{}, meta)
+}
+
+// FromOutgoingContext returns a copy of the metadata sent with the outgoing calls.
+func FromOutgoingContext(ctx context.Context) (map[string]string, bool) {
+	meta, ok := ctx.Value(metaKey{}).(map[string]string)
+	return copyMeta(meta, 0), ok
+}
+
+// Deprecated: use NewIncomingContext.
 func NewOutRequestContext(ctx context.Context, meta map[string]string) context.Context {
-	return context.WithValue(ctx, metaRequestKey{}, meta)
+	return NewIncomingContext(ctx, meta)
 }
 
+// Deprecated: use FromIncomingContext.
 func FromOutRequestContext(ctx context.Context) (map[string]string, bool) {
-	val := ctx.Value(metaRequestKey{})
-	meta, ok := val.(map[string]string)
-	if ok {
-		return meta, true
-	}
-	return map[string]string{}, false
+	return FromIncomingContext(ctx)
 }
 
+// Deprecated: use FromOutgoingContext.
 func FromOutContext(ctx context.Context) (map[string]string, bool) {
-	val := ctx.Value(metaKey{})
-	meta, ok := val.(map[string]string)
-	if ok {
-		return meta, true
+	return FromOutgoingContext(ctx)
+}
+
+func copyMeta(meta map[string]string, extra int) map[string]string {
+	newMeta := make(map[string]string, len(meta)+extra)
+	for k, v := range meta {
+		newMeta[k] = v
 	}
-	return map[string]string{}, false
+	return newMeta
 }
@@ -0,0 +1,53 @@
+package meta
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := NewOutgoingContext(context.Background(), map[string]string{"a": "1"})
+	child := AppendToOutgoingContext(ctx, "b", "2", "a", "3")
+
+	meta, ok := FromOutgoingContext(ctx)
+	if !ok || len(meta) != 1 || meta["a"] != "1" {
+		t.Fatalf("parent metadata changed: %v", meta)
+	}
+	meta, _ = FromOutgoingContext(child)
+	if meta["a"] != "3" || meta["b"] != "2" {
+		t.Fatalf("unexpected child metadata: %v", meta)
+	}
+
+	meta["c"] = "4"
+	if again, _ := FromOutgoingContext(child); len(again) != 2 {
+		t.Fatalf("returned metadata is not a copy: %v", again)
+	}
+}
+
+func TestIncomingContext(t *testing.T) {
+	ctx := NewIncomingContext(context.Background(), map[string]string{"trace-id": "t"})
+	if _, ok := FromOutgoingContext(ctx); ok {
+		t.Fatal("incoming metadata must not be sent with outgoing calls")
+	}
+	if v := ValueFromIncomingContext(ctx, "trace-id"); v != "t" {
+		t.Fatalf("unexpected value %q", v)
+	}
+}
+
+func TestResponseMeta(t *testing.T) {
+	if err := SetHeader(context.Background(), "a", "1"); err != ErrNoResponseContext {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ctx := NewResponseContext(context.Background())
+	SetHeader(ctx, "cursor", "10")
+	SetTrailer(ctx, "cost", "3ms")
+
+	header, trailer := SplitResponse(ResponseFromContext(ctx))
+	if len(header) != 1 || header["cursor"] != "10" {
+		t.Fatalf("unexpected header %v", header)
+	}
+	if len(trailer) != 1 || trailer["cost"] != "3ms" {
+		t.Fatalf("unexpected trailer %v", trailer)
+	}
+}
@@ -0,0 +1,96 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// TrailerPrefix marks the trailer keys in the metadata of a response frame.
+const TrailerPrefix = "trailer-"
+
+var ErrNoResponseContext = fmt.Errorf("meta: context is not serving a request")
+
+type responseKey struct{}
+
+type responseMeta struct {
+	mu      sync.Mutex
+	header  map[string]string
+	trailer map[string]string
+}
+
+// NewResponseContext returns a context in which the handler of a request can
+// set the headers and trailers of its response.
+func NewResponseContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, responseKey{}, &responseMeta{})
+}
+
+// SetHeader adds the key value pairs to the headers of the response.
+func SetHeader(ctx context.Context, kv ...string) error {
+	return setResponseMeta(ctx, false, kv...)
+}
+
+// SetTrailer adds the key value pairs to the trailers of the response.
+func SetTrailer(ctx context.Context, kv ...string) error {
+	return setResponseMeta(ctx, true, kv...)
+}
+
+func setResponseMeta(ctx context.Context, trailer bool, kv ...string) error {
+	if len(kv)%2 == 1 {
+		return fmt.Errorf("meta: got an odd number of input pairs: %d", len(kv))
+	}
+	rm, ok := ctx.Value(responseKey{}).(*responseMeta)
+	if !ok {
+		return ErrNoResponseContext
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	md := &rm.header
+	if trailer {
+		md = &rm.trailer
+	}
+	if *md == nil {
+		*md = make(map[string]string, len(kv)/2)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		(*md)[kv[i]] = kv[i+1]
+	}
+	return nil
+}
+
+// ResponseFromContext returns the headers and trailers set by the handler
+// merged into the metadata of a response frame.
+func ResponseFromContext(ctx context.Context) map[string]string {
+	rm, ok := ctx.Value(responseKey{}).(*responseMeta)
+	if !ok {
+		return nil
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if len(rm.header) == 0 && len(rm.trailer) == 0 {
+		return nil
+	}
+	md := make(map[string]string, len(rm.header)+len(rm.trailer))
+	for k, v := range rm.header {
+		md[k] = v
+	}
+	for k, v := range rm.trailer {
+		md[TrailerPrefix+k] = v
+	}
+	return md
+}
+
+// SplitResponse splits the metadata of a response frame into headers and trailers.
+func SplitResponse(md map[string]string) (header, trailer map[string]string) {
+	header = make(map[string]string, len(md))
+	trailer = make(map[string]string)
+	for k, v := range md {
+		if strings.HasPrefix(k, TrailerPrefix) {
+			trailer[strings.TrimPrefix(k, TrailerPrefix)] = v
+		} else {
+			header[k] = v
+		}
+	}
+	return header, trailer
+}
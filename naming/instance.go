@@ -0,0 +1,58 @@
+// Package naming defines the service instances published to a registry and
+// returned by a discovery.
+package naming
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const DefaultWeight = 100
+
+// ErrUnknownInstance is returned by a registry asked to keep alive an
+// instance it does not know, the instance has to be registered again.
+var ErrUnknownInstance = fmt.Errorf("unknown instance")
+
+type Instance struct {
+	Name     string            `json:"name"`
+	Addr     string            `json:"addr"`
+	Protocol string            `json:"protocol,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Weight   int               `json:"weight,omitempty"`
+	Zone     string            `json:"zone,omitempty"`
+	Region   string            `json:"region,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// HasTag reports whether the instance carries the tag.
+func (ins *Instance) HasTag(tag string) bool {
+	for _, t := range ins.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Addrs returns the addresses of the instances.
+func Addrs(instances []*Instance) []string {
+	addrs := make([]string, 0, len(instances))
+	for _, ins := range instances {
+		addrs = append(addrs, ins.Addr)
+	}
+	return addrs
+}
+
+// Signature returns a string equal for two lists of the same instances
+// whatever their order, to tell whether a route table changed.
+func Signature(instances []*Instance) string {
+	sorted := make([]*Instance, len(instances))
+	copy(sorted, instances)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Addr < sorted[j].Addr
+	})
+	bs, _ := json.Marshal(sorted)
+	return string(bs)
+}
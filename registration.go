@@ -0,0 +1,170 @@
+package microgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/xlog"
+	"go.uber.org/zap"
+	"time"
+)
+
+const readinessCheckInterval = time.Second
+
+var (
+	registerRetryBackoff    = time.Second
+	registerRetryMaxBackoff = 30 * time.Second
+)
+
+// SetReadinessCheck sets the readiness check of the default application.
+func SetReadinessCheck(check func() error) {
+	DefaultApplication().SetReadinessCheck(check)
+}
+
+// SetReadinessCheck sets the check that must pass before the servers are
+// published to the registry. When it keeps failing for readiness-failure-timeout
+// the servers are unregistered, and registered again once it passes.
+func (app *Application) SetReadinessCheck(check func() error) {
+	app.registrationMu.Lock()
+	app.readinessCheck = check
+	app.registrationMu.Unlock()
+}
+
+func (app *Application) checkReadiness() (err error) {
+	app.registrationMu.Lock()
+	readinessCheck := app.readinessCheck
+	app.registrationMu.Unlock()
+	if readinessCheck == nil {
+		return nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("readiness check panic: %v", e)
+		}
+	}()
+	return readinessCheck()
+}
+
+// maintainRegistration registers the servers once they are ready, retrying
+// with backoff, then keeps them alive until the application stops.
+func (app *Application) maintainRegistration() {
+	if app.registry == nil {
+		return
+	}
+	conf := app.Config()
+	var (
+		interval       = time.Duration(conf.KeepAlive) * time.Millisecond
+		failureTimeout = time.Duration(conf.ReadinessFailureTimeout) * time.Millisecond
+		backoff        = registerRetryBackoff
+		registered     bool
+		failingSince   time.Time
+	)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-app.doneCh:
+			return
+		}
+
+		next := interval
+		readyErr := app.checkReadiness()
+
+		app.registrationMu.Lock()
+		if app.isClosed.Load() {
+			app.registrationMu.Unlock()
+			return
+		}
+		switch {
+		case !registered && readyErr != nil:
+			xlog.Info(context.TODO(), "wait for readiness", zap.Error(readyErr))
+			next = readinessCheckInterval
+		case !registered:
+			if err := app.registerServers(); err != nil {
+				xlog.Error(context.TODO(), "register server failed", zap.Duration("retry", backoff), zap.Error(err))
+				next = backoff
+				if backoff *= 2; backoff > registerRetryMaxBackoff {
+					backoff = registerRetryMaxBackoff
+				}
+				break
+			}
+			registered = true
+			backoff = registerRetryBackoff
+		case readyErr != nil:
+			if failingSince.IsZero() {
+				failingSince = time.Now()
+			}
+			if time.Since(failingSince) < failureTimeout {
+				xlog.Warn(context.TODO(), "readiness check failed", zap.Error(readyErr))
+				app.keepAliveServers()
+				break
+			}
+			xlog.Error(context.TODO(), "readiness check keeps failing, unregister", zap.Error(readyErr))
+			app.unregisterServers()
+			registered = false
+			failingSince = time.Time{}
+			next = readinessCheckInterval
+		default:
+			failingSince = time.Time{}
+			app.keepAliveServers()
+		}
+		app.registrationMu.Unlock()
+
+		timer.Reset(next)
+	}
+}
+
+// closeRegistration unregisters the servers once and stops the registration,
+// it is called when the application starts to stop.
+func (app *Application) closeRegistration() {
+	app.registrationMu.Lock()
+	defer app.registrationMu.Unlock()
+	if app.isClosed.Swap(true) {
+		return
+	}
+	if app.registry != nil {
+		app.unregisterServers()
+	}
+}
+
+func (app *Application) registerServers() error {
+	var errs []error
+	for _, srv := range app.serverMap {
+		if err := app.registry.Register(app.serverInstance(srv)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		xlog.Info(context.TODO(), "register server", zap.String("server", srv.Name()))
+	}
+	return errors.Join(errs...)
+}
+
+// keepAliveServers renews the servers, a server the registry does not know
+// anymore, e.g. after its ttl passed or the registry restarted, is registered again.
+func (app *Application) keepAliveServers() {
+	for _, srv := range app.serverMap {
+		ins := app.serverInstance(srv)
+		err := app.registry.KeepAlive(ins)
+		if errors.Is(err, naming.ErrUnknownInstance) {
+			xlog.Warn(context.TODO(), "instance unknown to registry, register again", zap.String("server", srv.Name()))
+			err = app.registry.Register(ins)
+		}
+		if err != nil {
+			xlog.Error(context.TODO(), "keepAlive failed", zap.String("server", srv.Name()), zap.Error(err))
+			continue
+		}
+		xlog.Info(context.TODO(), "keepAlive", zap.String("server", srv.Name()))
+	}
+}
+
+func (app *Application) unregisterServers() {
+	for _, srv := range app.serverMap {
+		if err := app.registry.UnRegister(app.serverInstance(srv)); err != nil {
+			xlog.Error(context.TODO(), "unregister server failed", zap.String("server", srv.Name()), zap.Error(err))
+			continue
+		}
+		xlog.Info(context.TODO(), "unregister server", zap.String("server", srv.Name()))
+	}
+}
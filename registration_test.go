@@ -0,0 +1,89 @@
+package microgo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YCloud160/microgo/naming"
+)
+
+type testServer struct {
+	name, addr string
+}
+
+func (s *testServer) Start() error { return nil }
+func (s *testServer) Stop() error  { return nil }
+func (s *testServer) Name() string { return s.name }
+func (s *testServer) Addr() string { return s.addr }
+
+// flakyRegistry fails the first registrations, then forgets the instance on
+// the first keepalive.
+type flakyRegistry struct {
+	mu        sync.Mutex
+	failures  int
+	forgotten bool
+	registers []time.Time
+	keepAlive int
+}
+
+func (r *flakyRegistry) Register(ins *naming.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registers = append(r.registers, time.Now())
+	if len(r.registers) <= r.failures {
+		return fmt.Errorf("registry unavailable")
+	}
+	return nil
+}
+
+func (r *flakyRegistry) UnRegister(ins *naming.Instance) error { return nil }
+
+func (r *flakyRegistry) KeepAlive(ins *naming.Instance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keepAlive++
+	if !r.forgotten {
+		r.forgotten = true
+		return naming.ErrUnknownInstance
+	}
+	return nil
+}
+
+func (r *flakyRegistry) state() ([]time.Time, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	registers := make([]time.Time, len(r.registers))
+	copy(registers, r.registers)
+	return registers, r.keepAlive
+}
+
+func TestRegistrationRetry(t *testing.T) {
+	backoff, maxBackoff := registerRetryBackoff, registerRetryMaxBackoff
+	registerRetryBackoff, registerRetryMaxBackoff = 50*time.Millisecond, time.Second
+	defer func() { registerRetryBackoff, registerRetryMaxBackoff = backoff, maxBackoff }()
+
+	app := newTestApplication(t, "keep-alive: 20\n")
+	r := &flakyRegistry{failures: 2}
+	app.registry = r
+	app.RegisterServer(&testServer{name: "demo.rpcServer", addr: "127.0.0.1:1"})
+	go app.maintainRegistration()
+	defer close(app.doneCh)
+
+	var (
+		registers []time.Time
+		keepAlive int
+	)
+	waitFor(t, "instance not registered again after it was forgotten", func() bool {
+		registers, keepAlive = r.state()
+		return len(registers) == 4 && keepAlive > 1
+	})
+	// 2 failures, the registration, then the one after the unknown keepalive
+	if gap := registers[1].Sub(registers[0]); gap < registerRetryBackoff {
+		t.Fatalf("expect a retry after %v, got %v", registerRetryBackoff, gap)
+	}
+	if gap := registers[2].Sub(registers[1]); gap < 2*registerRetryBackoff {
+		t.Fatalf("expect the backoff doubled, got %v", gap)
+	}
+}
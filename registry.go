@@ -1,21 +1,332 @@
 package microgo
 
 import (
+	"errors"
+	"fmt"
 	"github.com/YCloud160/microgo/config"
+	"github.com/YCloud160/microgo/internal/consul"
+	"github.com/YCloud160/microgo/internal/gossip"
 	registry2 "github.com/YCloud160/microgo/internal/registry"
+	"github.com/YCloud160/microgo/naming"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Registry interface {
+	Register(ins *naming.Instance) error
+	UnRegister(ins *naming.Instance) error
+	KeepAlive(ins *naming.Instance) error
+}
+
+// AddrRegistry is the former form of Registry publishing only the name and
+// the address of the instances, see RegistryFromAddr.
+type AddrRegistry interface {
 	Register(name string, addr string) error
 	UnRegister(name string, addr string) error
 	KeepAlive(name string, addr string) error
 }
 
-var registry Registry
+// RegistryFromAddr adapts an AddrRegistry to Registry, the instance metadata is dropped.
+func RegistryFromAddr(r AddrRegistry) Registry {
+	return &addrRegistry{r: r}
+}
+
+type addrRegistry struct {
+	r AddrRegistry
+}
+
+func (ar *addrRegistry) Register(ins *naming.Instance) error {
+	return ar.r.Register(ins.Name, ins.Addr)
+}
+
+func (ar *addrRegistry) UnRegister(ins *naming.Instance) error {
+	return ar.r.UnRegister(ins.Name, ins.Addr)
+}
+
+func (ar *addrRegistry) KeepAlive(ins *naming.Instance) error {
+	return ar.r.KeepAlive(ins.Name, ins.Addr)
+}
+
+// RegistryBuilder creates the registry described by conf, conf.Data holds
+// the settings of the backend.
+type RegistryBuilder func(conf *config.Registry) (Registry, error)
+
+// appRegistryBuilder is a RegistryBuilder given the application, for the
+// backends holding state owned by it.
+type appRegistryBuilder func(app *Application, conf *config.Registry) (Registry, error)
+
+var (
+	builderMu        sync.Mutex
+	registryBuilders = make(map[string]appRegistryBuilder)
+)
+
+func init() {
+	RegisterRegistryBuilder("micro-route", func(conf *config.Registry) (Registry, error) {
+		return registry2.NewMicroRegistry(conf.Data["host"]), nil
+	})
+	RegisterRegistryBuilder("file", func(conf *config.Registry) (Registry, error) {
+		ttl := time.Duration(3*conf.Parent().KeepAlive) * time.Millisecond
+		if v, err := strconv.ParseInt(conf.Data["ttl"], 10, 64); err == nil && v > 0 {
+			ttl = time.Duration(v) * time.Millisecond
+		}
+		return registry2.NewFileRegistry(fileRegistryPath(conf), ttl), nil
+	})
+	RegisterRegistryBuilder("consul", func(conf *config.Registry) (Registry, error) {
+		return registry2.NewConsulRegistry(newConsulClient(conf)), nil
+	})
+	registryBuilders["gossip"] = func(app *Application, conf *config.Registry) (Registry, error) {
+		node, err := app.gossipNode(conf)
+		if err != nil {
+			return nil, err
+		}
+		return registry2.NewGossipRegistry(node), nil
+	}
+}
+
+// RegisterRegistryBuilder makes the registry backend available under name
+// in the registry configuration. It must be called before Run.
+func RegisterRegistryBuilder(name string, builder RegistryBuilder) {
+	builderMu.Lock()
+	defer builderMu.Unlock()
+	registryBuilders[name] = func(_ *Application, conf *config.Registry) (Registry, error) {
+		return builder(conf)
+	}
+}
+
+func (app *Application) buildRegistry(conf *config.Registry) (Registry, error) {
+	builderMu.Lock()
+	builder, ok := registryBuilders[conf.Name]
+	builderMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown registry %q", conf.Name)
+	}
+	return builder(app, conf)
+}
+
+// initRegistry builds the registries of the configuration, the instances are
+// published to all of them.
+func (app *Application) initRegistry() error {
+	conf := app.Config()
+	var confs []*config.Registry
+	if conf.Registry != nil {
+		confs = append(confs, conf.Registry)
+	}
+	confs = append(confs, conf.Registries...)
+
+	var registries multiRegistry
+	for _, rc := range confs {
+		r, err := app.buildRegistry(rc)
+		if err != nil {
+			return err
+		}
+		registries = append(registries, r)
+	}
+	switch len(registries) {
+	case 0:
+	case 1:
+		app.registry = registries[0]
+	default:
+		app.registry = registries
+	}
+	return nil
+}
+
+// multiRegistry publishes the instances to several registries, e.g. while
+// migrating from one backend to another.
+type multiRegistry []Registry
+
+func (mr multiRegistry) Register(ins *naming.Instance) error {
+	return mr.each(func(r Registry) error {
+		return r.Register(ins)
+	})
+}
+
+func (mr multiRegistry) UnRegister(ins *naming.Instance) error {
+	return mr.each(func(r Registry) error {
+		return r.UnRegister(ins)
+	})
+}
+
+func (mr multiRegistry) KeepAlive(ins *naming.Instance) error {
+	return mr.each(func(r Registry) error {
+		return r.KeepAlive(ins)
+	})
+}
+
+func (mr multiRegistry) each(fn func(r Registry) error) error {
+	var errs []error
+	for _, r := range mr {
+		if err := fn(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileRegistryPath is the file shared by the file registry and discovery,
+// data.path or microgo-registry.json under the base dir.
+func fileRegistryPath(conf *config.Registry) string {
+	if path := conf.Data["path"]; len(path) > 0 {
+		return path
+	}
+	dir := conf.Parent().BaseDir
+	if len(dir) == 0 {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "microgo-registry.json")
+}
+
+const (
+	defaultConsulHost            = "127.0.0.1:8500"
+	defaultConsulDeregisterAfter = time.Minute
+)
+
+// newConsulClient creates the client of the agent at data.host, data.token
+// and data.dc are optional. The check ttl is data.ttl or three keepalives,
+// data.deregister-after how long a critical instance is kept and
+// data.timeout the timeout of the requests, in milliseconds.
+func newConsulClient(conf *config.Registry) *consul.Client {
+	client := &consul.Client{
+		Host:            conf.Data["host"],
+		Token:           conf.Data["token"],
+		Datacenter:      conf.Data["dc"],
+		TTL:             time.Duration(3*conf.Parent().KeepAlive) * time.Millisecond,
+		DeregisterAfter: defaultConsulDeregisterAfter,
+	}
+	if len(client.Host) == 0 {
+		client.Host = defaultConsulHost
+	}
+	if v, err := strconv.ParseInt(conf.Data["ttl"], 10, 64); err == nil && v > 0 {
+		client.TTL = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.ParseInt(conf.Data["deregister-after"], 10, 64); err == nil && v > 0 {
+		client.DeregisterAfter = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.ParseInt(conf.Data["timeout"], 10, 64); err == nil && v > 0 {
+		client.Timeout = time.Duration(v) * time.Millisecond
+	}
+	return client
+}
+
+const (
+	defaultGossipBind           = ":7946"
+	defaultGossipProbeInterval  = time.Second
+	defaultGossipProbeTimeout   = 500 * time.Millisecond
+	defaultGossipSuspectTimeout = 3 * time.Second
+	defaultGossipIndirectProbes = 3
+)
+
+// gossipNode returns the node of the application listening on data.bind,
+// shared by the gossip registry and discovery and closed when it stops.
+// data.advertise is the address given to the other members, local-ip and the
+// bind port by default, data.seeds the comma separated addresses of the
+// members to join. data.probe-interval, data.probe-timeout and
+// data.suspect-timeout are in milliseconds.
+func (app *Application) gossipNode(conf *config.Registry) (*gossip.Node, error) {
+	bind := conf.Data["bind"]
+	if len(bind) == 0 {
+		bind = defaultGossipBind
+	}
+
+	app.gossipMu.Lock()
+	defer app.gossipMu.Unlock()
+	if node, ok := app.gossipNodes[bind]; ok {
+		return node, nil
+	}
+
+	gc := gossip.Config{
+		Bind:           bind,
+		Advertise:      conf.Data["advertise"],
+		ProbeInterval:  defaultGossipProbeInterval,
+		ProbeTimeout:   defaultGossipProbeTimeout,
+		SuspectTimeout: defaultGossipSuspectTimeout,
+		IndirectProbes: defaultGossipIndirectProbes,
+	}
+	if len(gc.Advertise) == 0 {
+		_, port, err := net.SplitHostPort(bind)
+		if err != nil {
+			return nil, err
+		}
+		gc.Advertise = net.JoinHostPort(conf.Parent().LocalIP, port)
+	}
+	for _, seed := range strings.Split(conf.Data["seeds"], ",") {
+		if seed = strings.TrimSpace(seed); len(seed) > 0 {
+			gc.Seeds = append(gc.Seeds, seed)
+		}
+	}
+	for key, d := range map[string]*time.Duration{
+		"probe-interval":  &gc.ProbeInterval,
+		"probe-timeout":   &gc.ProbeTimeout,
+		"suspect-timeout": &gc.SuspectTimeout,
+	} {
+		if v, err := strconv.ParseInt(conf.Data[key], 10, 64); err == nil && v > 0 {
+			*d = time.Duration(v) * time.Millisecond
+		}
+	}
+	if gc.ProbeTimeout >= gc.ProbeInterval {
+		return nil, fmt.Errorf("gossip probe-timeout must be less than probe-interval")
+	}
+
+	node, err := gossip.NewNode(gc)
+	if err != nil {
+		return nil, err
+	}
+	if app.gossipNodes == nil {
+		app.gossipNodes = make(map[string]*gossip.Node)
+	}
+	app.gossipNodes[bind] = node
+	return node, nil
+}
+
+// closeGossipNodes leaves the gossip members of the application.
+func (app *Application) closeGossipNodes() {
+	app.gossipMu.Lock()
+	defer app.gossipMu.Unlock()
+	for bind, node := range app.gossipNodes {
+		node.Close()
+		delete(app.gossipNodes, bind)
+	}
+}
+
+type instanceServer interface {
+	Instance() *naming.Instance
+}
+
+// serverInstance returns the instance published for the server.
+func (app *Application) serverInstance(srv Server) *naming.Instance {
+	if is, ok := srv.(instanceServer); ok {
+		return is.Instance()
+	}
+	return &naming.Instance{
+		Name:   srv.Name(),
+		Addr:   srv.Addr(),
+		Weight: naming.DefaultWeight,
+		Zone:   app.Config().LocalZone,
+	}
+}
 
-func initRegistry(conf *config.Registry) {
-	switch conf.Name {
-	case "micro-route":
-		registry = registry2.NewMicroRegistry(conf.Data["host"])
+func (app *Application) newServerInstance(srv Server, protocol string, conf *config.ServerConfig) *naming.Instance {
+	ins := &naming.Instance{
+		Name:     srv.Name(),
+		Addr:     srv.Addr(),
+		Protocol: protocol,
+		Version:  conf.Version,
+		Weight:   int(conf.Weight),
+		Zone:     conf.Zone,
+		Region:   conf.Region,
+		Tags:     conf.Tags,
+		Labels:   conf.Labels,
+	}
+	if ins.Weight <= 0 {
+		ins.Weight = naming.DefaultWeight
+	}
+	if len(ins.Zone) == 0 {
+		ins.Zone = app.Config().LocalZone
 	}
+	return ins
 }
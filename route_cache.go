@@ -0,0 +1,70 @@
+package microgo
+
+import (
+	"encoding/json"
+	"github.com/YCloud160/microgo/naming"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const routeCacheDir = "route-cache"
+
+var routeCacheMu sync.Mutex
+
+// routeSnapshot is the last known good route table of a service, kept on
+// disk so a client created while the registry is down still has hosts.
+type routeSnapshot struct {
+	Name      string             `json:"name"`
+	UpdatedAt time.Time          `json:"updated-at"`
+	Instances []*naming.Instance `json:"instances"`
+}
+
+func routeCachePath(dir, name string) string {
+	if len(dir) == 0 {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, routeCacheDir, name+".json")
+}
+
+// loadRouteCache returns the instances of the last snapshot of the service.
+func loadRouteCache(dir, name string) ([]*naming.Instance, error) {
+	routeCacheMu.Lock()
+	defer routeCacheMu.Unlock()
+
+	bs, err := os.ReadFile(routeCachePath(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &routeSnapshot{}
+	if err := json.Unmarshal(bs, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot.Instances, nil
+}
+
+// saveRouteCache replaces the snapshot of the service, an empty route table
+// is never saved.
+func saveRouteCache(dir, name string, instances []*naming.Instance) error {
+	if len(instances) == 0 {
+		return nil
+	}
+	bs, err := json.Marshal(&routeSnapshot{Name: name, UpdatedAt: time.Now(), Instances: instances})
+	if err != nil {
+		return err
+	}
+
+	routeCacheMu.Lock()
+	defer routeCacheMu.Unlock()
+
+	path := routeCachePath(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
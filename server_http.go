@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/YCloud160/microgo/config"
 	"github.com/YCloud160/microgo/meta"
+	"github.com/YCloud160/microgo/naming"
+	"github.com/YCloud160/microgo/utils/header"
 	"github.com/YCloud160/microgo/utils/xlog"
 	"go.uber.org/zap"
 	"net"
@@ -12,6 +14,7 @@ import (
 )
 
 type ServerHTTP struct {
+	app        *Application
 	name       string
 	conf       *config.ServerConfig
 	httpServer *http.Server
@@ -23,7 +26,6 @@ func NewHttpServer(name string, mux http.Handler) Server {
 	srv := &ServerHTTP{
 		name: name,
 		mux:  mux,
-		conf: config.GetServerConfig(name),
 	}
 	srv.httpServer = &http.Server{
 		Handler: srv,
@@ -31,13 +33,22 @@ func NewHttpServer(name string, mux http.Handler) Server {
 	return srv
 }
 
+func (srv *ServerHTTP) bind(app *Application) {
+	srv.app = app
+	srv.conf = app.Config().GetServerConfig(srv.name)
+}
+
+// reloadConfig is a no-op, none of the settings of an http server can
+// change while it runs.
+func (srv *ServerHTTP) reloadConfig(conf *config.ServerConfig) {}
+
 func (srv *ServerHTTP) Start() error {
 	listenAddr := ":" + srv.conf.Port
 	listen, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		return err
 	}
-	startWaitGroup.Done()
+	srv.app.startWaitGroup.Done()
 	xlog.Info(context.TODO(), "start http server", zap.String("server", srv.Name()), zap.String("listen", srv.conf.Port))
 	return srv.httpServer.Serve(listen)
 }
@@ -53,15 +64,21 @@ func (srv *ServerHTTP) Name() string {
 }
 
 func (srv *ServerHTTP) Addr() string {
-	conf := config.GetConfig()
-	return fmt.Sprintf("%s:%s", conf.LocalIP, srv.conf.Port)
+	return fmt.Sprintf("%s:%s", srv.app.Config().LocalIP, srv.conf.Port)
+}
+
+func (srv *ServerHTTP) Instance() *naming.Instance {
+	return srv.app.newServerInstance(srv, "http", srv.conf)
 }
 
 func (srv *ServerHTTP) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	ctx := context.TODO()
 	ctxData := make(map[string]string)
+	if traceData := req.Header.Get(header.Tracer); len(traceData) > 0 {
+		ctxData[header.Tracer] = traceData
+	}
 	ctx, ctxData = setTrace(ctx, ctxData, "http request")
-	ctx = meta.NewOutRequestContext(ctx, ctxData)
+	ctx = meta.NewIncomingContext(ctx, ctxData)
 	req = req.WithContext(ctx)
 
 	defer xlog.Recover(ctx)
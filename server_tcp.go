@@ -6,6 +6,7 @@ import (
 	"github.com/YCloud160/microgo/config"
 	ierrors "github.com/YCloud160/microgo/errors"
 	"github.com/YCloud160/microgo/meta"
+	"github.com/YCloud160/microgo/naming"
 	"github.com/YCloud160/microgo/utils/header"
 	"github.com/YCloud160/microgo/utils/tracer"
 	"github.com/YCloud160/microgo/utils/xlog"
@@ -21,6 +22,7 @@ const (
 )
 
 type ServerTCP struct {
+	app  *Application
 	name string
 	mu   sync.Mutex
 
@@ -39,23 +41,44 @@ type ServerTCP struct {
 func NewTCPServer(name string, impl any, call Call) Server {
 	srv := &ServerTCP{
 		name:  name,
-		conf:  config.GetServerConfig(name),
 		conns: make(map[*conn]struct{}),
 		impl:  impl,
 		call:  call,
 	}
-	srv.tick = make(chan struct{}, srv.conf.MaxInvoke)
 	return srv
 }
 
+func (srv *ServerTCP) bind(app *Application) {
+	srv.app = app
+	srv.reloadConfig(app.Config().GetServerConfig(srv.name))
+}
+
+// reloadConfig applies conf, the requests in flight keep the invoke limit
+// they were admitted with.
+func (srv *ServerTCP) reloadConfig(conf *config.ServerConfig) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.conf == nil || srv.conf.MaxInvoke != conf.MaxInvoke {
+		srv.tick = make(chan struct{}, conf.MaxInvoke)
+	}
+	srv.conf = conf
+}
+
+func (srv *ServerTCP) config() (*config.ServerConfig, chan struct{}) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.conf, srv.tick
+}
+
 func (srv *ServerTCP) Start() error {
-	listenAddr := ":" + srv.conf.Port
+	conf, _ := srv.config()
+	listenAddr := ":" + conf.Port
 	listen, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		return err
 	}
-	startWaitGroup.Done()
-	xlog.Info(context.TODO(), "start tcp server", zap.String("server", srv.Name()), zap.String("listen", srv.conf.Port))
+	srv.app.startWaitGroup.Done()
+	xlog.Info(context.TODO(), "start tcp server", zap.String("server", srv.Name()), zap.String("listen", conf.Port))
 	srv.listen = listen
 	return srv.accept()
 }
@@ -84,8 +107,13 @@ func (srv *ServerTCP) Name() string {
 }
 
 func (srv *ServerTCP) Addr() string {
-	conf := config.GetConfig()
-	return fmt.Sprintf("%s:%s", conf.LocalIP, srv.conf.Port)
+	conf, _ := srv.config()
+	return fmt.Sprintf("%s:%s", srv.app.Config().LocalIP, conf.Port)
+}
+
+func (srv *ServerTCP) Instance() *naming.Instance {
+	conf, _ := srv.config()
+	return srv.app.newServerInstance(srv, "tcp", conf)
 }
 
 func (srv *ServerTCP) accept() error {
@@ -159,10 +187,11 @@ type outChan struct {
 }
 
 func (srv *ServerTCP) invoke(conn *conn, req *Message) {
+	conf, tick := srv.config()
 	ctx := context.TODO()
 	var cancel context.CancelFunc
-	if srv.conf.InvokeTimeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(srv.conf.InvokeTimeout))
+	if conf.InvokeTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(conf.InvokeTimeout))
 		defer cancel()
 	}
 
@@ -178,10 +207,10 @@ func (srv *ServerTCP) invoke(conn *conn, req *Message) {
 		conn.sendMessage(resp)
 		putMessage(resp)
 		return
-	case srv.tick <- struct{}{}:
+	case tick <- struct{}{}:
 	}
 	defer func() {
-		<-srv.tick
+		<-tick
 	}()
 
 	ctxData := req.Data.Meta
@@ -190,7 +219,8 @@ func (srv *ServerTCP) invoke(conn *conn, req *Message) {
 	}
 	ctxData[header.RemoteIP] = conn.ip
 	ctx, ctxData = setTrace(ctx, ctxData, req.Data.Method)
-	ctx = meta.NewOutRequestContext(ctx, ctxData)
+	ctx = meta.NewIncomingContext(ctx, ctxData)
+	ctx = meta.NewResponseContext(ctx)
 	contentType := ctxData[header.ContentType]
 	enc := GetEncoder(contentType)
 
@@ -221,6 +251,7 @@ func (srv *ServerTCP) invoke(conn *conn, req *Message) {
 	}
 	close(respCh)
 
+	resp.Data.Meta = meta.ResponseFromContext(ctx)
 	if ok {
 		resp.Data.Body = respData.data
 		if respData.err != nil {
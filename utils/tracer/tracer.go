@@ -78,6 +78,12 @@ func WithNewTracer(ctx context.Context, name string) (context.Context, *Tracer)
 	return context.WithValue(ctx, _tracerKey, trace), trace
 }
 
+// FromContext returns the tracer of the context, nil if there is none.
+func FromContext(ctx context.Context) *Tracer {
+	trace, _ := ctx.Value(_tracerKey).(*Tracer)
+	return trace
+}
+
 func ParseTrace(s string) *Tracer {
 	trace := &Tracer{}
 	if err := json.Unmarshal([]byte(s), trace); err != nil {
@@ -12,15 +12,66 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	logFd *zap.Logger
-	level zap.AtomicLevel
+	logFd atomic.Pointer[zap.Logger]
+	// level is shared by the loggers of NewLogger so that SetLevel applies
+	// to them.
+	level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 )
 
+func init() {
+	logFd.Store(NewLogger(&config.Config{}))
+}
+
 func InitXlog(conf *config.Config) {
+	SetLogger(NewLogger(conf))
+}
+
+// SetLogger sets the logger written to by the package functions.
+func SetLogger(logger *zap.Logger) {
+	logFd.Store(logger)
+}
+
+// SetLevel sets the minimum level logged by the loggers of NewLogger, debug
+// when empty.
+func SetLevel(l string) error {
+	return UpdateLevel(level, l)
+}
+
+// UpdateLevel sets the minimum level of lvl, debug when l is empty.
+func UpdateLevel(lvl zap.AtomicLevel, l string) error {
+	parsed := zapcore.DebugLevel
+	if len(l) > 0 {
+		if err := parsed.UnmarshalText([]byte(l)); err != nil {
+			return err
+		}
+	}
+	lvl.SetLevel(parsed)
+	return nil
+}
+
+// Logger returns the logger written to by the package functions.
+func Logger() *zap.Logger {
+	return logFd.Load()
+}
+
+// NewLogger returns the logger configured by conf, it writes to stderr
+// unless a log dir is set. Its level is the one of SetLevel, set to the
+// level of conf.
+func NewLogger(conf *config.Config) *zap.Logger {
+	if err := SetLevel(conf.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return NewLevelLogger(conf, level)
+}
+
+// NewLevelLogger is NewLogger with its own level lvl, the level of conf is
+// not applied to it.
+func NewLevelLogger(conf *config.Config, lvl zap.AtomicLevel) *zap.Logger {
 	service := conf.Service
 	if len(service) == 0 {
 		service = fmt.Sprintf("%d", rand.Uint32()+1000)
@@ -42,13 +93,13 @@ func InitXlog(conf *config.Config) {
 	}
 
 	encoder := zapcore.NewJSONEncoder(encodeConf)
-	level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	core := zapcore.NewCore(encoder, output, level)
-	logFd = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2), zap.AddStacktrace(zapcore.DPanicLevel))
-	logFd = logFd.With(zap.Int("pid", os.Getpid()))
+	core := zapcore.NewCore(encoder, output, lvl)
+	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2), zap.AddStacktrace(zapcore.DPanicLevel))
+	logger = logger.With(zap.Int("pid", os.Getpid()))
 	if len(conf.Service) > 0 {
-		logFd = logFd.With(zap.String("service", conf.Service))
+		logger = logger.With(zap.String("service", conf.Service))
 	}
+	return logger
 }
 
 func Debug(ctx context.Context, msg string, fields ...zap.Field) {
@@ -79,17 +130,9 @@ func Fatal(ctx context.Context, msg string, fields ...zap.Field) {
 	write(ctx, zapcore.FatalLevel, msg, fields...)
 }
 
-//func SetLevel(level string) {
-//	lowerLevel := strings.ToLower(level)
-//	l, ok := LevelName[lowerLevel]
-//	if ok {
-//		fd.level = l
-//	}
-//}
-
 func write(ctx context.Context, level zapcore.Level, msg string, fields ...zap.Field) {
 	fields = withContext(ctx, fields...)
-	logFd.Log(level, msg, fields...)
+	logFd.Load().Log(level, msg, fields...)
 }
 
 func Recover(ctx context.Context) {
@@ -99,15 +142,11 @@ func Recover(ctx context.Context) {
 }
 
 func withContext(ctx context.Context, fields ...zap.Field) []zap.Field {
-	data, ok := meta.FromOutRequestContext(ctx)
-	if !ok {
-		return fields
-	}
-	traceId := data[header.TraceID]
+	traceId := meta.ValueFromIncomingContext(ctx, header.TraceID)
 	if len(traceId) > 0 {
 		fields = append(fields, zap.String("traceId", traceId))
 	}
-	spanId := data[header.SpanID]
+	spanId := meta.ValueFromIncomingContext(ctx, header.SpanID)
 	if len(spanId) > 0 {
 		fields = append(fields, zap.String("spanId", spanId))
 	}